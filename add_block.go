@@ -1,14 +1,76 @@
 package main
 
+import "time"
+
 // AddBlock contains the arguments used for the add-block command.
 type AddBlock struct {
 	Name         string
 	Text         string
+	Markup       bool
 	Left         bool
 	Center       bool
 	Right        bool
 	Command      string
 	TailCommand  string
-	Interval     int
+	JSON         bool
+	Interval     string
+	Align        bool
+	Schedule     string
+	Signal       int
 	ClickCommand string
+	OnError      string
+	ErrorText    string
+	UrgentCode   int
+	HideCode     int
+	FlashBar     bool
+	Exec         bool
+	Dir          string
+	Limits       Limits
+
+	Tooltip        string
+	TooltipCommand string
+
+	Priority int
+
+	MinWidth  string
+	MaxWidth  int
+	Overflow  string
+	TextAlign string
+
+	Scroll      bool
+	ScrollSpeed float64
+
+	HideEmpty bool
+	Companion string
+
+	ImagePath string
+	IconName  string
+	IconSize  int
+
+	Type     string
+	Min      float64
+	Max      float64
+	Vertical bool
+	Low      float64
+	High     float64
+	Critical float64
+
+	GraphSize  int
+	GraphStyle string
+	AutoScale  bool
+
+	Restart         string
+	RestartDelay    time.Duration
+	RestartMaxDelay time.Duration
+
+	MenuCommand string
+	MenuButton  string
+
+	FlashOnChange time.Duration
+	Blink         bool
+
+	Format string
+
+	Source          string
+	TooltipTemplate string
 }
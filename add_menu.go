@@ -4,4 +4,15 @@ type AddMenu struct {
 	Name    string
 	Text    string
 	Command string
+	// ID identifies the item for edit-menu and remove-menu
+	ID string
+	// Parent is the text of the item whose submenu the item goes in
+	Parent    string
+	Separator bool
+	Check     bool
+	// Radio is the name of the group of radio items the item belongs to
+	Radio string
+	// StateCommand decides if check and radio items are active, by exiting
+	// with code 0
+	StateCommand string
 }
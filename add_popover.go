@@ -0,0 +1,18 @@
+package main
+
+// AddPopover contains the arguments used for the add-popover command.
+type AddPopover struct {
+	Name string
+	Type string
+	Text string
+	// Command is run by buttons and calendars, and its output is shown by
+	// labels
+	Command string
+	// GetCommand reads the state of sliders and toggles, SetCommand writes
+	// it with "{}" replaced by the new value
+	GetCommand string
+	SetCommand string
+	Min        float64
+	Max        float64
+	Step       float64
+}
@@ -0,0 +1,10 @@
+package main
+
+// AddSource contains the arguments used for the add-source command.
+type AddSource struct {
+	Name     string
+	Command  string
+	Interval string
+	Align    bool
+	Schedule string
+}
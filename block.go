@@ -6,7 +6,10 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/gotk3/gotk3/gtk"
@@ -17,11 +20,90 @@ type Block struct {
 	AddBlock
 	EventBox *gtk.EventBox
 	Label    *gtk.Label
+	Image    *gtk.Image
 	Menu     *gtk.Menu
+	Popover  *gtk.Popover
+	box      *gtk.Box
+	levelBar *gtk.LevelBar
+	graph    *gtk.DrawingArea
+	history  *History
+
+	menuItems    []*MenuItem
+	radioGroups  map[string]*gtk.RadioMenuItem
+	menuUpdating bool
+	dynamicMenu  []*gtk.MenuItem
+	popoverBox   *gtk.Box
+	popoverItems []*PopoverItem
+
+	mutex   sync.Mutex
+	job     *Job
+	source  *Source
+	tailCmd *exec.Cmd
+	// running is set while the command runs, and again when it should run
+	// once more after that
+	running bool
+	again   bool
+
+	format          *template.Template
+	tooltipTemplate *template.Template
+
+	stopped chan struct{}
+	// state only used on the gtk thread
+	failed     bool
+	urgent     bool
+	exitHidden bool
+	// hasOutput is set once a command gave the block its text, so that
+	// replacing the initial text isn't highlighted as a change
+	hasOutput     bool
+	changedSerial int
+	blinking      bool
+	blinkOn       bool
+	// userHidden is set by the hide command and ownerHidden when the block
+	// is the companion of a hidden block
+	userHidden  bool
+	ownerHidden bool
+
+	text           string
+	shortText      string
+	useShortText   bool
+	overflowHidden bool
+	outputIcon     string
+	outputImage    string
+	imageLoaded    bool
+	shownIcon      string
+	shownImage     string
+
+	statusTooltip  string
+	outputTooltip  string
+	commandTooltip string
+	tooltipRunning bool
+	tooltipUpdated time.Time
+
+	labelMarkup      string
+	viewport         *gtk.Viewport
+	scrollAdjustment *gtk.Adjustment
+	scrollWidth      int
+	scrollMarkup     string
+	scrollLoop       float64
+	scrollOffset     float64
+	scrollPaused     bool
+	scrollTick       int
+	scrollLastFrame  int64
 }
 
-// Initialize builds widgets and sets up triggers.
+// Initialize builds widgets and sets up triggers. When a flag turns out to
+// be invalid, the commands and jobs started so far are stopped again.
 func (b *Block) Initialize() error {
+	b.stopped = make(chan struct{})
+
+	err := b.initialize()
+	if err != nil {
+		b.stop()
+	}
+	return err
+}
+
+func (b *Block) initialize() error {
 	err := b.initializeEventBox()
 	if err != nil {
 		return err
@@ -32,12 +114,62 @@ func (b *Block) Initialize() error {
 		return err
 	}
 
+	err = b.initializeImage()
+	if err != nil {
+		return err
+	}
+
+	err = b.initializeLevel()
+	if err != nil {
+		return err
+	}
+
+	err = b.initializeGraph()
+	if err != nil {
+		return err
+	}
+
+	err = b.initializeWidth()
+	if err != nil {
+		return err
+	}
+
+	err = b.initializeScroll()
+	if err != nil {
+		return err
+	}
+
+	err = b.initializeTooltip()
+	if err != nil {
+		return err
+	}
+
+	err = b.initializeFormat()
+	if err != nil {
+		return err
+	}
+
 	err = b.initializeCommand()
 	if err != nil {
 		return err
 	}
 
-	err = b.initializeClickCommand()
+	err = b.initializeSource()
+	if err != nil {
+		return err
+	}
+
+	err = b.initializeSignal()
+	if err != nil {
+		return err
+	}
+
+	err = b.initializeMenuCommand()
+	if err != nil {
+		return err
+	}
+
+	err = b.initializeClick()
 	if err != nil {
 		return err
 	}
@@ -53,27 +185,42 @@ func (b *Block) Initialize() error {
 func (b *Block) initializeEventBox() error {
 	return executeGtkSync(func() error {
 		eventBox, err := gtk.EventBoxNew()
+		if err != nil {
+			return err
+		}
 		b.EventBox = eventBox
-		return err
-	})
-}
+		// blocks manage their own visibility
+		b.EventBox.SetNoShowAll(true)
 
-func (b *Block) initializeLabel() error {
-	return executeGtkSync(func() error {
-		label, err := gtk.LabelNew(b.Text)
+		box, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 0)
 		if err != nil {
 			return err
 		}
-		b.Label = label
-		b.EventBox.Add(label)
-		err = applyClass(&label.Widget, "block")
+		b.box = box
+		b.EventBox.Add(box)
+		b.box.Show()
+
+		// classes go on the box holding the label, image, level bar or
+		// graph, so that they are all styled as one block
+		err = applyClass(&box.Widget, "block")
 		if err != nil {
 			return err
 		}
-		err = applyClass(&label.Widget, b.Name)
+		return applyClass(&box.Widget, b.Name)
+	})
+}
+
+func (b *Block) initializeLabel() error {
+	return executeGtkSync(func() error {
+		label, err := gtk.LabelNew("")
 		if err != nil {
 			return err
 		}
+		b.Label = label
+		b.text = b.Text
+		b.updateLabel()
+		b.box.PackStart(label, true, true, 0)
+		b.Label.Show()
 		return nil
 	})
 }
@@ -83,99 +230,471 @@ func (b *Block) initializeCommand() error {
 		return nil
 	}
 
+	schedule, err := b.schedule()
+	if err != nil {
+		return err
+	}
+
 	b.startUpdatingLabel()
 
-	if b.Interval != 0 {
-		duration, _ := time.ParseDuration(fmt.Sprintf("%ds", b.Interval))
-		tick := time.Tick(duration)
-		go func() {
-			for range tick {
-				b.startUpdatingLabel()
-			}
-		}()
+	if schedule != nil {
+		b.job = scheduler.Add(schedule, b.startUpdatingLabel)
 	}
 
 	return nil
 }
 
+func (b *Block) schedule() (Schedule, error) {
+	schedule, err := newSchedule(b.Interval, b.Schedule, b.Align)
+	if err != nil {
+		return nil, fmt.Errorf("block %s: %v", b.Name, err)
+	}
+	return schedule, nil
+}
+
+func (b *Block) initializeSignal() error {
+	if b.Signal == 0 {
+		return nil
+	}
+
+	sig, err := blockSignal(b.Signal)
+	if err != nil {
+		return err
+	}
+	signal.Notify(signals, sig)
+	return nil
+}
+
 func (b *Block) initializeTailCommand() error {
 	if b.TailCommand == "" {
 		return nil
 	}
+	// without a delay a crashing command would be restarted in a tight loop
+	if b.Restart != "never" {
+		if b.RestartDelay <= 0 {
+			return fmt.Errorf("block %s needs a positive --restart-delay", b.Name)
+		}
+		if b.RestartMaxDelay < b.RestartDelay {
+			return fmt.Errorf("block %s needs a --restart-max-delay of at least --restart-delay", b.Name)
+		}
+	}
 	b.startUpdatingLabelForever()
 	return nil
 }
 
-func (b *Block) initializeClickCommand() error {
-	if b.ClickCommand == "" {
-		return nil
+func (b *Block) startUpdatingLabel() {
+	if b.source != nil {
+		b.source.run()
+		return
 	}
 
-	return executeGtkSync(func() error {
-		_, err := b.EventBox.Connect("button-release-event", func() {
-			go func() {
-				cmd := exec.Command("/bin/bash", "-c", b.ClickCommand)
-				err := cmd.Run()
-				if err != nil {
-					log.Printf("ClickCommand finished with error: %v", err)
-				}
-			}()
-		})
-		return err
-	})
-}
+	// slow commands would pile up and could finish out of order, so runs
+	// asked for while the command is running are merged into one after it
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.running {
+		b.again = true
+		return
+	}
+	b.running = true
 
-func (b *Block) startUpdatingLabel() {
 	go func() {
-		cmd := exec.Command("/bin/bash", "-c", b.Command)
-		cmd.Stderr = os.Stderr
-
-		stdout, err := cmd.Output()
-		if err == nil {
-			b.setText(strings.TrimSpace(string(stdout)))
-		} else {
-			log.Printf("Command finished with error: %v", err)
-			b.setText("ERROR")
+		for {
+			stdout, err := b.runner(b.Command).Output()
+			output, formatErr := b.formatOutput(stdout, err)
+			if formatErr != nil {
+				b.setError(formatErr)
+			} else {
+				b.handleOutput(output, err)
+			}
+
+			b.mutex.Lock()
+			again := b.again && !b.isStopped()
+			b.again = false
+			b.running = again
+			b.mutex.Unlock()
+			if !again {
+				return
+			}
 		}
 	}()
 }
 
+// handleOutput shows the output of a command that exited with err.
+func (b *Block) handleOutput(output Output, err error) {
+	// like i3blocks, commands can use their exit code to mark the block as
+	// urgent or to hide it
+	switch exitCode(err) {
+	case 0:
+		b.setState(output, false, false)
+	case b.UrgentCode:
+		b.setState(output, true, false)
+	case b.HideCode:
+		b.setState(output, false, true)
+	default:
+		b.setError(err)
+	}
+}
+
+// runner returns a Runner that runs with the block's settings.
+func (b *Block) runner(command string) Runner {
+	return Runner{
+		Command: command,
+		Exec:    b.Exec,
+		Dir:     b.Dir,
+		Limits:  b.Limits.Or(limits),
+	}
+}
+
+// runCommandWith runs a command from a check or radio item or a popover
+// widget with "{}" replaced by value.
+func (b *Block) runCommandWith(command string, value string) {
+	b.runCommand(strings.Replace(command, "{}", value, -1))
+}
+
+// runCommand runs a command from a menu item or popover button.
+func (b *Block) runCommand(command string) {
+	if command == "" {
+		return
+	}
+	err := b.runner(command).Run()
+	if err != nil {
+		log.Printf("Command finished with error: %v", err)
+	}
+}
+
 func (b *Block) setText(text string) {
-	err := executeGtkSync(func() error {
-		b.Label.SetText(text)
-		return nil
-	})
+	output, err := b.formatOutput([]byte(text), nil)
 	if err != nil {
-		log.Printf("Error setting text: %v", err)
+		b.setError(err)
+		return
 	}
+	b.setState(output, false, false)
 }
 
-func (b *Block) startUpdatingLabelForever() {
-	go func() {
-		cmd := exec.Command("/bin/bash", "-c", b.TailCommand)
-		cmd.Stderr = os.Stderr
+func (b *Block) parseOutput(raw string) Output {
+	return parseOutput(raw, b.JSON)
+}
 
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			log.Printf("Couldn't get a stdout from command: %v", err)
-			b.setText("ERROR")
-			return
+// setState queues the output to be shown.
+func (b *Block) setState(output Output, urgent bool, hidden bool) {
+	if b.isStopped() {
+		return
+	}
+	updates.Push(b, blockUpdate{output: output, urgent: urgent, hidden: hidden})
+}
+
+// showState shows the output and leaves the error state, marking the block
+// as urgent or hiding it when asked to. It must be called on the gtk thread.
+func (b *Block) showState(output Output, urgent bool, hidden bool) error {
+	if !hidden {
+		if b.FlashOnChange > 0 && b.hasOutput && output.Text != b.text {
+			b.flashChanged()
 		}
-		err = cmd.Start()
-		if err != nil {
-			log.Printf("TailCommand finished with error: %v", err)
-			b.setText("ERROR")
-			return
+		b.hasOutput = true
+		b.text = output.Text
+		b.shortText = output.ShortText
+		b.outputTooltip = output.Tooltip
+		b.outputIcon = output.Icon
+		b.outputImage = output.Image
+		b.updateLabel()
+		b.updateImage()
+		if b.levelBar != nil {
+			b.updateLevel(output)
 		}
+		if b.graph != nil {
+			b.updateGraph(output)
+		}
+	}
+	b.exitHidden = hidden
+	err := b.setUrgent(urgent)
+	if err != nil {
+		return err
+	}
+	err = b.clearError()
+	if err != nil {
+		return err
+	}
+	b.updateVisibility()
+	return nil
+}
+
+// updateLabel shows the text, or the short text when the bar doesn't have
+// enough space. It must be called on the gtk thread.
+func (b *Block) updateLabel() {
+	if b.useShortText && b.shortText != "" {
+		b.setLabel(b.shortText)
+	} else {
+		b.setLabel(b.text)
+	}
+}
+
+// setOverflow switches to the short text or hides the block when the bar
+// doesn't have enough space. It must be called on the gtk thread.
+func (b *Block) setOverflow(useShortText bool, hidden bool) {
+	if b.useShortText != useShortText {
+		b.useShortText = useShortText
+		b.updateLabel()
+	}
+	b.overflowHidden = hidden
+	b.updateVisibility()
+}
+
+// setLabel sets the label text, which is Pango markup when Markup is set.
+// Anything else is escaped so that command output can't inject markup. It
+// must be called on the gtk thread.
+func (b *Block) setLabel(text string) {
+	text = b.labelMarkupFor(text)
+	b.Label.SetMarkup(text)
+	b.labelMarkup = text
+	if b.viewport != nil {
+		b.updateScroll()
+	}
+}
+
+// labelMarkupFor returns the markup the label shows for text.
+func (b *Block) labelMarkupFor(text string) string {
+	markup := b.Markup && isValidMarkup(text)
+	text = b.truncate(text, markup)
+	if !markup {
+		text = escapeMarkup(text)
+	}
+	return text
+}
+
+func (b *Block) setUrgent(urgent bool) error {
+	if b.urgent == urgent {
+		return nil
+	}
+	b.urgent = urgent
+	if b.FlashBar {
+		window.updateUrgency()
+	}
+	if urgent && b.Blink {
+		b.startBlinking()
+	}
+	if urgent {
+		return applyClass(&b.box.Widget, "urgent")
+	}
+	return removeClass(&b.box.Widget, "urgent")
+}
 
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			b.setText(strings.TrimSpace(scanner.Text()))
+// updateVisibility shows or hides the block depending on its state. It
+// must be called on the gtk thread.
+func (b *Block) updateVisibility() {
+	visible := b.visible()
+	b.EventBox.SetVisible(visible)
+
+	if b.Companion != "" {
+		companion := window.findBlock(b.Companion)
+		if companion != nil && companion.ownerHidden == visible {
+			companion.ownerHidden = !visible
+			companion.updateVisibility()
 		}
-		if err := scanner.Err(); err != nil {
-			log.Printf("Couldn't read from command stdout: %v", err)
-			b.setText("ERROR")
-			return
+	}
+}
+
+func (b *Block) visible() bool {
+	return !b.overflowHidden && !b.ownerHidden && b.wantsVisible()
+}
+
+// wantsVisible tells if the block would be visible if there was space for
+// it and its owner.
+func (b *Block) wantsVisible() bool {
+	if b.userHidden || b.exitHidden {
+		return false
+	}
+	if b.failed && b.OnError == "hide" {
+		return false
+	}
+	return !b.HideEmpty || b.text != ""
+}
+
+// setError puts the block in the error state, which adds the error class
+// and handles the text according to OnError.
+func (b *Block) setError(err error) {
+	log.Printf("Command for block %s finished with error: %v", b.Name, err)
+	if b.isStopped() {
+		return
+	}
+	updates.Push(b, blockUpdate{err: err})
+}
+
+// showError puts the block in the error state. It must be called on the
+// gtk thread.
+func (b *Block) showError(err error) error {
+	tooltip := err.Error()
+	if commandErr, ok := err.(*CommandError); ok {
+		tooltip = fmt.Sprintf("Exit code: %d", commandErr.ExitCode())
+		if commandErr.Stderr != "" {
+			tooltip += "\n" + commandErr.Stderr
+		}
+	}
+
+	b.failed = true
+	b.statusTooltip = tooltip
+	if b.OnError == "text" {
+		b.text = b.ErrorText
+		b.shortText = ""
+		b.updateLabel()
+	}
+	b.updateVisibility()
+	return applyClass(&b.box.Widget, "error")
+}
+
+// clearError leaves the error state. It must be called on the gtk thread.
+func (b *Block) clearError() error {
+	if !b.failed {
+		return nil
+	}
+	b.failed = false
+	b.statusTooltip = ""
+	return removeClass(&b.box.Widget, "error")
+}
+
+func (b *Block) startUpdatingLabelForever() {
+	go func() {
+		delay := b.RestartDelay
+		for {
+			started := time.Now()
+			err := b.tail()
+			if b.isStopped() {
+				return
+			}
+			b.setExitStatus(err)
+
+			if !b.shouldRestart(err) {
+				return
+			}
+			// a command that ran for a while isn't crash looping, so start
+			// backing off from the beginning again
+			if time.Since(started) > b.RestartMaxDelay {
+				delay = b.RestartDelay
+			}
+			select {
+			case <-time.After(delay):
+			case <-b.stopped:
+				return
+			}
+			delay *= 2
+			if delay > b.RestartMaxDelay {
+				delay = b.RestartMaxDelay
+			}
 		}
 	}()
 }
+
+// tail runs TailCommand until it exits, using every line it writes as the
+// block text.
+func (b *Block) tail() error {
+	runner := b.runner(b.TailCommand)
+	cmd, err := runner.Cmd()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = processes.Start(cmd)
+	if err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	b.tailCmd = cmd
+	stopped := b.isStopped()
+	b.mutex.Unlock()
+	if stopped {
+		processes.Kill(cmd)
+	}
+	b.clearExitStatus()
+
+	scanner := bufio.NewScanner(stdout)
+	if max := runner.Limits.MaxOutput; max > 0 {
+		size := max
+		if size > 4096 {
+			size = 4096
+		}
+		scanner.Buffer(make([]byte, 0, size), int(max))
+	}
+	for scanner.Scan() {
+		b.setText(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Couldn't read from command stdout: %v", err)
+		processes.Kill(cmd)
+	}
+
+	return processes.Wait(cmd)
+}
+
+func (b *Block) shouldRestart(err error) bool {
+	switch b.Restart {
+	case "always":
+		return true
+	case "on-failure":
+		return err != nil
+	}
+	return false
+}
+
+func (b *Block) setExitStatus(err error) {
+	status := "exit status 0"
+	if err != nil {
+		status = err.Error()
+	}
+	log.Printf("TailCommand for block %s finished: %s", b.Name, status)
+
+	err = executeGtkSync(func() error {
+		// show the last lines before the exit status
+		updates.apply()
+		b.statusTooltip = fmt.Sprintf("tail-command: %s", status)
+		return applyClass(&b.box.Widget, "exited")
+	})
+	if err != nil {
+		log.Printf("Error setting exit status: %v", err)
+	}
+}
+
+func (b *Block) clearExitStatus() {
+	err := executeGtkSync(func() error {
+		b.statusTooltip = ""
+		return removeClass(&b.box.Widget, "exited")
+	})
+	if err != nil {
+		log.Printf("Error clearing exit status: %v", err)
+	}
+}
+
+// stop stops every command belonging to the block.
+func (b *Block) stop() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.isStopped() {
+		return
+	}
+	close(b.stopped)
+	updates.Forget(b)
+
+	if b.job != nil {
+		scheduler.Remove(b.job)
+	}
+	if b.source != nil {
+		b.source.Unsubscribe(b)
+	}
+	if b.tailCmd != nil {
+		processes.Kill(b.tailCmd)
+	}
+}
+
+func (b *Block) isStopped() bool {
+	select {
+	case <-b.stopped:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,6 @@
+package main
+
+// ClearMenu contains the arguments used for the clear-menu command.
+type ClearMenu struct {
+	Name string
+}
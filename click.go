@@ -0,0 +1,121 @@
+package main
+
+import (
+	"log"
+
+	"github.com/gotk3/gotk3/gdk"
+)
+
+// mouseButtons maps --menu-button names to gdk button numbers.
+var mouseButtons = map[string]uint{
+	"left":   1,
+	"middle": 2,
+	"right":  3,
+}
+
+// initializeClick handles clicks and key presses on the block. The menu
+// button opens the popover or menu, and any other button runs the click
+// command.
+func (b *Block) initializeClick() error {
+	return executeGtkSync(func() error {
+		_, err := b.EventBox.Connect("button-release-event", b.buttonReleased)
+		if err != nil {
+			return err
+		}
+		_, err = b.EventBox.Connect("key-press-event", b.keyPressed)
+		if err != nil {
+			return err
+		}
+		b.updateFocus()
+		return nil
+	})
+}
+
+// menuButton returns the button that opens the menu. Unless it's set it's
+// the right button for blocks with a click command, and the left button
+// otherwise.
+func (b *Block) menuButton() uint {
+	if button, ok := mouseButtons[b.MenuButton]; ok {
+		return button
+	}
+	if b.ClickCommand != "" {
+		return mouseButtons["right"]
+	}
+	return mouseButtons["left"]
+}
+
+// hasMenu tells if the block has a popover or a menu with items to show.
+// Cleared menus don't take over the click.
+func (b *Block) hasMenu() bool {
+	if b.Popover != nil {
+		return true
+	}
+	return b.Menu != nil && (len(b.menuItems) > 0 || b.MenuCommand != "")
+}
+
+// activateMenu opens the popover of the block, or its menu. It must be
+// called on the gtk thread.
+func (b *Block) activateMenu() {
+	if b.Popover != nil {
+		b.openPopover()
+	} else {
+		b.openMenu()
+	}
+}
+
+func (b *Block) click() {
+	go func() {
+		err := b.runner(b.ClickCommand).Run()
+		if err != nil {
+			log.Printf("ClickCommand finished with error: %v", err)
+		}
+	}()
+}
+
+func (b *Block) buttonReleased(_ interface{}, event *gdk.Event) bool {
+	button := gdk.EventButtonNewFromEvent(event).Button()
+	switch {
+	case button == b.menuButton() && b.hasMenu():
+		b.activateMenu()
+	case b.ClickCommand != "":
+		b.click()
+	default:
+		return false
+	}
+	return true
+}
+
+// keyPressed makes focused blocks work from the keyboard. Enter and space
+// act like the left button, and the menu key or shift+F10 open the menu.
+func (b *Block) keyPressed(_ interface{}, event *gdk.Event) bool {
+	key := gdk.EventKeyNewFromEvent(event)
+	switch key.KeyVal() {
+	case gdk.KEY_Return, gdk.KEY_KP_Enter, gdk.KEY_space:
+		if b.menuButton() == mouseButtons["left"] && b.hasMenu() {
+			b.activateMenu()
+		} else if b.ClickCommand != "" {
+			b.click()
+		} else {
+			return false
+		}
+	case gdk.KEY_Menu:
+		if !b.hasMenu() {
+			return false
+		}
+		b.activateMenu()
+	case gdk.KEY_F10:
+		if key.State()&uint(gdk.GDK_SHIFT_MASK) == 0 || !b.hasMenu() {
+			return false
+		}
+		b.activateMenu()
+	default:
+		return false
+	}
+	return true
+}
+
+// updateFocus lets the block take the keyboard focus when it does
+// something when activated. It must be called on the gtk thread.
+func (b *Block) updateFocus() {
+	b.EventBox.SetCanFocus(b.ClickCommand != "" || b.hasMenu())
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// shell runs every command that isn't executed directly. It can be changed
+// with `vbar start --shell`.
+var shell = "bash"
+
+// setShell sets the shell from a name like "sh" or a path.
+func setShell(name string) error {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return fmt.Errorf("can't find shell %s: %v", name, err)
+	}
+	shell = path
+	return nil
+}
+
+// Limits restricts the resources a command can use. Zero values mean no
+// limit, except for Nice which is nil when unset so that a block can go
+// back to 0.
+type Limits struct {
+	Nice        *int
+	IONice      string
+	MemoryLimit int64
+	CPULimit    time.Duration
+	MaxOutput   int64
+}
+
+// limits are the global Limits, set with `vbar start`.
+var limits Limits
+
+// Or fills in any unset limits from defaults.
+func (l Limits) Or(defaults Limits) Limits {
+	if l.Nice == nil {
+		l.Nice = defaults.Nice
+	}
+	if l.IONice == "" {
+		l.IONice = defaults.IONice
+	}
+	if l.MemoryLimit == 0 {
+		l.MemoryLimit = defaults.MemoryLimit
+	}
+	if l.CPULimit == 0 {
+		l.CPULimit = defaults.CPULimit
+	}
+	if l.MaxOutput == 0 {
+		l.MaxOutput = defaults.MaxOutput
+	}
+	return l
+}
+
+// wrapper returns the nice, ionice and prlimit invocation that applies the
+// limits to a command. The limits are applied before the command starts
+// so that they are inherited by anything it runs.
+func (l Limits) wrapper() []string {
+	var args []string
+	if l.Nice != nil && *l.Nice != 0 {
+		args = append(args, "nice", "-n", strconv.Itoa(*l.Nice))
+	}
+	if class, ok := ioniceClasses[l.IONice]; ok {
+		args = append(args, "ionice", "-c", class)
+	}
+	if l.MemoryLimit != 0 || l.CPULimit != 0 {
+		args = append(args, "prlimit")
+		if l.MemoryLimit != 0 {
+			args = append(args, fmt.Sprintf("--as=%d", l.MemoryLimit))
+		}
+		if l.CPULimit != 0 {
+			// prlimit only takes whole seconds, so round up rather than
+			// give commands less time than asked for
+			seconds := int64((l.CPULimit + time.Second - 1) / time.Second)
+			args = append(args, fmt.Sprintf("--cpu=%d", seconds))
+		}
+		args = append(args, "--")
+	}
+	return args
+}
+
+// ioniceClasses maps --ionice names to ionice classes. "none" has no
+// class, and only overrides the global class.
+var ioniceClasses = map[string]string{
+	"realtime":    "1",
+	"best-effort": "2",
+	"idle":        "3",
+}
+
+// optionalInt is a flag value that remembers if it was set.
+type optionalInt struct {
+	value *int
+}
+
+func optionalIntFlag(flag *kingpin.FlagClause) *optionalInt {
+	o := &optionalInt{}
+	flag.SetValue(o)
+	return o
+}
+
+func (o *optionalInt) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	o.value = &n
+	return nil
+}
+
+func (o *optionalInt) String() string {
+	if o.value == nil {
+		return ""
+	}
+	return strconv.Itoa(*o.value)
+}
+
+// Runner runs every command started by vbar for a block.
+type Runner struct {
+	Command string
+	// Exec runs the command without the shell
+	Exec   bool
+	Dir    string
+	Limits Limits
+}
+
+// Cmd creates the exec.Cmd. Commands are run by the shell unless Exec is
+// set, in which case the command is split into arguments and executed
+// directly.
+func (r Runner) Cmd() (*exec.Cmd, error) {
+	var args []string
+	if r.Exec {
+		var err error
+		args, err = splitArguments(r.Command)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("empty command")
+		}
+	} else {
+		args = []string{shell, "-c", r.Command}
+	}
+	args = append(r.Limits.wrapper(), args...)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	if r.Dir != "" {
+		cmd.Dir = expandHome(r.Dir)
+	}
+	return cmd, nil
+}
+
+// Run runs the command and waits for it to finish.
+func (r Runner) Run() error {
+	cmd, err := r.Cmd()
+	if err != nil {
+		return err
+	}
+	return cmd.Run()
+}
+
+// Output runs the command in its own process group and returns what it
+// wrote to stdout, up to MaxOutput bytes. When the command fails the error
+// is a CommandError.
+func (r Runner) Output() ([]byte, error) {
+	cmd, err := r.Cmd()
+	if err != nil {
+		return nil, &CommandError{Err: err}
+	}
+
+	stdout := &limitedBuffer{max: r.Limits.MaxOutput}
+	stderr := &limitedBuffer{max: maxStderr}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = processes.Start(cmd)
+	if err == nil {
+		err = processes.Wait(cmd)
+	}
+	if err != nil {
+		return stdout.Bytes(), &CommandError{
+			Err:    err,
+			Stderr: strings.TrimSpace(stderr.String()),
+		}
+	}
+	return stdout.Bytes(), nil
+}
+
+// maxStderr is how much of stderr is kept for error messages.
+const maxStderr = 4096
+
+// CommandError describes a command that couldn't be started or that
+// exited with an error.
+type CommandError struct {
+	Err    error
+	Stderr string
+}
+
+func (e *CommandError) Error() string {
+	if e.Stderr == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v: %s", e.Err, e.Stderr)
+}
+
+// ExitCode returns the exit code of the command, or -1 if it didn't exit
+// normally.
+func (e *CommandError) ExitCode() int {
+	if exitErr, ok := e.Err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// exitCode returns the exit code of a command from the error returned by
+// Output.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if commandErr, ok := err.(*CommandError); ok {
+		return commandErr.ExitCode()
+	}
+	return -1
+}
+
+// limitedBuffer is a bytes.Buffer that quietly drops anything written
+// after it holds max bytes.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.max > 0 {
+		space := b.max - int64(b.Len())
+		if space <= 0 {
+			return n, nil
+		}
+		if int64(len(p)) > space {
+			p = p[:space]
+		}
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// splitArguments splits a command line into arguments the way a shell
+// would, understanding single quotes, double quotes and backslashes, but
+// without any expansion.
+func splitArguments(command string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range command {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", command)
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitArguments(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"   ", nil, false},
+		{"date", []string{"date"}, false},
+		{"date +%H:%M", []string{"date", "+%H:%M"}, false},
+		{"  echo \t a\nb  ", []string{"echo", "a", "b"}, false},
+		{`echo 'a b' "c d"`, []string{"echo", "a b", "c d"}, false},
+		{`echo 'say "hi"'`, []string{"echo", `say "hi"`}, false},
+		{`echo "it's"`, []string{"echo", "it's"}, false},
+		{`echo a'b c'd`, []string{"echo", "ab cd"}, false},
+		{`echo a\ b`, []string{"echo", "a b"}, false},
+		{`echo \"a\"`, []string{"echo", `"a"`}, false},
+		{`echo "a \"b\" \\"`, []string{"echo", `a "b" \`}, false},
+		{`echo 'a\b'`, []string{"echo", `a\b`}, false},
+		{`echo '' ""`, []string{"echo", "", ""}, false},
+		{`echo \$HOME ~`, []string{"echo", "$HOME", "~"}, false},
+		{`echo 'a`, nil, true},
+		{`echo "a`, nil, true},
+		{`echo "a'`, nil, true},
+		{`echo a\`, nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := splitArguments(test.command)
+		if (err != nil) != test.wantErr {
+			t.Errorf("splitArguments(%q) error = %v, want error %v", test.command, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitArguments(%q) = %q, want %q", test.command, got, test.want)
+		}
+	}
+}
+
+func TestLimitsWrapper(t *testing.T) {
+	zero, ten := 0, 10
+
+	tests := []struct {
+		limits Limits
+		want   []string
+	}{
+		{Limits{}, nil},
+		{Limits{Nice: &zero}, nil},
+		{Limits{Nice: &ten}, []string{"nice", "-n", "10"}},
+		{Limits{IONice: "idle"}, []string{"ionice", "-c", "3"}},
+		{Limits{IONice: "none"}, nil},
+		{Limits{MemoryLimit: 1 << 20}, []string{"prlimit", "--as=1048576", "--"}},
+		{Limits{CPULimit: 10 * time.Second}, []string{"prlimit", "--cpu=10", "--"}},
+		{Limits{CPULimit: 1500 * time.Millisecond}, []string{"prlimit", "--cpu=2", "--"}},
+		{Limits{CPULimit: 100 * time.Millisecond}, []string{"prlimit", "--cpu=1", "--"}},
+		{
+			Limits{Nice: &ten, IONice: "best-effort", MemoryLimit: 1000, CPULimit: time.Minute},
+			[]string{"nice", "-n", "10", "ionice", "-c", "2", "prlimit", "--as=1000", "--cpu=60", "--"},
+		},
+	}
+
+	for _, test := range tests {
+		got := test.limits.wrapper()
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v.wrapper() = %q, want %q", test.limits, got, test.want)
+		}
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	tests := []struct {
+		max    int64
+		writes []string
+		want   string
+	}{
+		{0, []string{"hello", " world"}, "hello world"},
+		{5, []string{"hello", " world"}, "hello"},
+		{8, []string{"hello", " world"}, "hello wo"},
+		{3, []string{"hello"}, "hel"},
+		{5, []string{"", "hi"}, "hi"},
+	}
+
+	for _, test := range tests {
+		buffer := &limitedBuffer{max: test.max}
+		for _, write := range test.writes {
+			n, err := buffer.Write([]byte(write))
+			if n != len(write) || err != nil {
+				t.Errorf("limitedBuffer{max: %d}.Write(%q) = %d, %v, want %d, nil", test.max, write, n, err, len(write))
+			}
+		}
+		if got := buffer.String(); got != test.want {
+			t.Errorf("limitedBuffer{max: %d} after %q = %q, want %q", test.max, test.writes, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronFieldParse(t *testing.T) {
+	tests := []struct {
+		field   cronField
+		value   string
+		want    uint64
+		wantErr bool
+	}{
+		{cronMinute, "5", 1 << 5, false},
+		{cronMinute, "1,3", 1<<1 | 1<<3, false},
+		{cronHour, "1-3", 1<<1 | 1<<2 | 1<<3, false},
+		{cronHour, "*/8", 1<<0 | 1<<8 | 1<<16, false},
+		{cronHour, "20/2", 1<<20 | 1<<22, false},
+		{cronMonth, "*", 0x1ffe, false},
+		{cronMinute, "60", 0, true},
+		{cronDayOfMonth, "0", 0, true},
+		{cronHour, "3-1", 0, true},
+		{cronMinute, "*/0", 0, true},
+		{cronMinute, "x", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := test.field.parse(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parse(%q) error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parse(%q) = %b, want %b", test.value, got, test.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expression := range []string{
+		"* * * *",
+		"* * * * * *",
+		"0 0 31 2 *",
+		"0 0 30,31 2 *",
+		"0 0 31 4,6,9,11 *",
+	} {
+		_, err := parseCron(expression)
+		if err == nil {
+			t.Errorf("parseCron(%q) should fail", expression)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		expression string
+		from       time.Time
+		want       time.Time
+	}{
+		{"* * * * *", date(2024, 3, 10, 14, 7).Add(30 * time.Second), date(2024, 3, 10, 14, 8)},
+		{"*/5 * * * *", date(2024, 3, 10, 14, 7), date(2024, 3, 10, 14, 10)},
+		{"0 0 * * *", date(2024, 3, 10, 14, 7), date(2024, 3, 11, 0, 0)},
+		// across the end of a month and a year
+		{"0 0 1 * *", date(2024, 1, 31, 12, 0), date(2024, 2, 1, 0, 0)},
+		{"30 9 * * *", date(2024, 12, 31, 10, 0), date(2025, 1, 1, 9, 30)},
+		// the 31st skips months without one
+		{"0 0 31 * *", date(2024, 4, 1, 0, 0), date(2024, 5, 31, 0, 0)},
+		// leap day
+		{"0 0 29 2 *", date(2025, 1, 1, 0, 0), date(2028, 2, 29, 0, 0)},
+		// 2024-03-10 is a sunday
+		{"0 8 * * 1", date(2024, 3, 10, 14, 7), date(2024, 3, 11, 8, 0)},
+		{"0 8 * * 0", date(2024, 3, 10, 14, 7), date(2024, 3, 17, 8, 0)},
+		{"0 8 * * 7", date(2024, 3, 10, 14, 7), date(2024, 3, 17, 8, 0)},
+		{"0 8 * * 1-5", date(2024, 3, 15, 9, 0), date(2024, 3, 18, 8, 0)},
+		// a day of the week in the next month
+		{"0 0 * * 5", date(2024, 3, 30, 0, 0), date(2024, 4, 5, 0, 0)},
+		// either day field matches when both are restricted
+		{"0 0 15 * 1", date(2024, 3, 12, 0, 0), date(2024, 3, 15, 0, 0)},
+		{"0 0 15 * 1", date(2024, 3, 16, 0, 0), date(2024, 3, 18, 0, 0)},
+		// like cron, both day fields must match when one starts with "*",
+		// so this is the next 15th on an even day of the week
+		{"0 0 15 * */2", date(2024, 3, 12, 0, 0), date(2024, 6, 15, 0, 0)},
+	}
+
+	for _, test := range tests {
+		schedule, err := parseCron(test.expression)
+		if err != nil {
+			t.Errorf("parseCron(%q) failed: %v", test.expression, err)
+			continue
+		}
+		got := schedule.Next(test.from)
+		if !got.Equal(test.want) {
+			t.Errorf("%q.Next(%v) = %v, want %v", test.expression, test.from, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+// EditMenu contains the arguments used for the edit-menu command.
+type EditMenu struct {
+	Name    string
+	ID      string
+	Text    string
+	Enable  bool
+	Disable bool
+	// Position moves the item within its menu, unless it's negative
+	Position int
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+)
+
+// blinkInterval is how often urgent blocks with --blink toggle the "blink"
+// class.
+const blinkInterval = 500 * time.Millisecond
+
+// flashChanged adds the "changed" class to the block for FlashOnChange, so
+// that themes can highlight new text. Another change while the class is
+// set keeps it for longer. It must be called on the gtk thread.
+func (b *Block) flashChanged() {
+	b.changedSerial++
+	serial := b.changedSerial
+
+	applyClass(&b.box.Widget, "changed")
+	glib.TimeoutAdd(uint(b.FlashOnChange/time.Millisecond), func() bool {
+		if b.changedSerial == serial {
+			removeClass(&b.box.Widget, "changed")
+		}
+		return false
+	})
+}
+
+// startBlinking toggles the "blink" class on the block for as long as it
+// is urgent. It must be called on the gtk thread.
+func (b *Block) startBlinking() {
+	if b.blinking {
+		return
+	}
+	b.blinking = true
+
+	glib.TimeoutAdd(uint(blinkInterval/time.Millisecond), func() bool {
+		if !b.urgent || b.isStopped() {
+			b.blinking = false
+			b.blinkOn = false
+			removeClass(&b.box.Widget, "blink")
+			return false
+		}
+
+		b.blinkOn = !b.blinkOn
+		if b.blinkOn {
+			applyClass(&b.box.Widget, "blink")
+		} else {
+			removeClass(&b.box.Widget, "blink")
+		}
+		return true
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// History is a ring buffer of the last values shown by a graph block.
+type History struct {
+	values []float64
+	start  int
+	count  int
+}
+
+// HistoryNew creates a History holding up to size values.
+func HistoryNew(size int) *History {
+	return &History{values: make([]float64, size)}
+}
+
+// Push adds a value, dropping the oldest one when the history is full.
+func (h *History) Push(value float64) {
+	if len(h.values) == 0 {
+		return
+	}
+	h.values[(h.start+h.count)%len(h.values)] = value
+	if h.count < len(h.values) {
+		h.count++
+	} else {
+		h.start = (h.start + 1) % len(h.values)
+	}
+}
+
+// Values returns the values from oldest to newest.
+func (h *History) Values() []float64 {
+	values := make([]float64, h.count)
+	for i := range values {
+		values[i] = h.values[(h.start+i)%len(h.values)]
+	}
+	return values
+}
+
+// initializeGraph replaces the label of graph blocks with a drawing area
+// that plots the recent values from the command output.
+func (b *Block) initializeGraph() error {
+	if b.Type != "graph" {
+		return nil
+	}
+	if b.GraphSize < 2 {
+		return fmt.Errorf("block %s needs a --graph-size of at least 2", b.Name)
+	}
+
+	return executeGtkSync(func() error {
+		drawingArea, err := gtk.DrawingAreaNew()
+		if err != nil {
+			return err
+		}
+		b.graph = drawingArea
+		b.history = HistoryNew(b.GraphSize)
+
+		drawingArea.SetSizeRequest(60, -1)
+		err = applyClass(&drawingArea.Widget, "graph")
+		if err != nil {
+			return err
+		}
+		_, err = drawingArea.Connect("draw", b.drawGraph)
+		if err != nil {
+			return err
+		}
+
+		b.Label.Hide()
+		b.box.PackStart(drawingArea, true, true, 0)
+		drawingArea.Show()
+		return nil
+	})
+}
+
+// updateGraph adds the value from output to the graph. It must be called
+// on the gtk thread.
+func (b *Block) updateGraph(output Output) {
+	value, ok := output.value()
+	if !ok {
+		return
+	}
+	b.history.Push(value)
+	b.graph.QueueDraw()
+}
+
+// graphRange returns the range to scale values to, which is Min to Max
+// unless the graph scales to the values it's showing.
+func (b *Block) graphRange(values []float64) (float64, float64) {
+	if !b.AutoScale {
+		return b.Min, b.Max
+	}
+
+	min, max := b.Min, math.Inf(-1)
+	for _, value := range values {
+		min = math.Min(min, value)
+		max = math.Max(max, value)
+	}
+	if max <= min {
+		max = min + 1
+	}
+	return min, max
+}
+
+// drawGraph draws the history as a line, or as a filled area, in the css
+// colour of the graph.
+func (b *Block) drawGraph(drawingArea *gtk.DrawingArea, cr *cairo.Context) bool {
+	values := b.history.Values()
+	if len(values) == 0 {
+		return false
+	}
+
+	width := float64(drawingArea.GetAllocatedWidth())
+	height := float64(drawingArea.GetAllocatedHeight())
+	min, max := b.graphRange(values)
+
+	styleContext, err := drawingArea.GetStyleContext()
+	if err != nil {
+		return false
+	}
+	color := styleContext.GetColor(styleContext.GetState()).Floats()
+
+	// the newest value is on the right edge, with room for GraphSize values
+	step := width / math.Max(float64(b.GraphSize-1), 1)
+	x := func(i int) float64 {
+		return width - float64(len(values)-1-i)*step
+	}
+	y := func(value float64) float64 {
+		scaled := (value - min) / (max - min)
+		return height - math.Max(0, math.Min(1, scaled))*height
+	}
+
+	cr.NewPath()
+	cr.MoveTo(x(0), y(values[0]))
+	for i, value := range values[1:] {
+		cr.LineTo(x(i+1), y(value))
+	}
+
+	if b.GraphStyle == "area" {
+		cr.LineTo(x(len(values)-1), height)
+		cr.LineTo(x(0), height)
+		cr.ClosePath()
+		cr.SetSourceRGBA(color[0], color[1], color[2], color[3])
+		cr.Fill()
+	} else {
+		cr.SetSourceRGBA(color[0], color[1], color[2], color[3])
+		cr.SetLineWidth(1.5)
+		cr.Stroke()
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	tests := []struct {
+		size   int
+		values []float64
+		want   []float64
+	}{
+		{3, nil, []float64{}},
+		{3, []float64{1, 2}, []float64{1, 2}},
+		{3, []float64{1, 2, 3}, []float64{1, 2, 3}},
+		{3, []float64{1, 2, 3, 4}, []float64{2, 3, 4}},
+		{3, []float64{1, 2, 3, 4, 5, 6, 7}, []float64{5, 6, 7}},
+		{1, []float64{1, 2}, []float64{2}},
+		{0, []float64{1, 2}, []float64{}},
+	}
+
+	for _, test := range tests {
+		history := HistoryNew(test.size)
+		for _, value := range test.values {
+			history.Push(value)
+		}
+		got := history.Values()
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("history of %d after %v = %v, want %v", test.size, test.values, got, test.want)
+		}
+	}
+}
+
+func TestGraphRange(t *testing.T) {
+	tests := []struct {
+		min, max  float64
+		autoScale bool
+		values    []float64
+		wantMin   float64
+		wantMax   float64
+	}{
+		{0, 100, false, []float64{5, 250}, 0, 100},
+		{0, 100, true, []float64{5, 25, 10}, 0, 25},
+		{0, 100, true, []float64{-10, 25}, -10, 25},
+		{0, 100, true, []float64{250}, 0, 250},
+		// a flat line still needs a range to scale to
+		{0, 100, true, []float64{0, 0}, 0, 1},
+		{10, 100, true, []float64{5, 5}, 5, 6},
+		{0, 100, true, nil, 0, 1},
+	}
+
+	for _, test := range tests {
+		block := &Block{AddBlock: AddBlock{Min: test.min, Max: test.max, AutoScale: test.autoScale}}
+		gotMin, gotMax := block.graphRange(test.values)
+		if gotMin != test.wantMin || gotMax != test.wantMax {
+			t.Errorf("graphRange(%v) with min %v, max %v and auto scale %v = %v, %v, want %v, %v",
+				test.values, test.min, test.max, test.autoScale, gotMin, gotMax, test.wantMin, test.wantMax)
+		}
+	}
+}
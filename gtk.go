@@ -3,6 +3,7 @@ package main
 /*
 #cgo pkg-config: gdk-3.0
 #cgo pkg-config: gtk+-3.0
+#include <stdlib.h>
 #include <gtk/gtk.h>
 #include <gdk/gdk.h>
 
@@ -21,11 +22,57 @@ static GtkMenu * toGtkMenu(void *p)
   return (GTK_MENU(p));
 }
 
+static GtkOrientable * toGtkOrientable(void *p)
+{
+  return (GTK_ORIENTABLE(p));
+}
+
 static GdkDisplay * toGdkDisplay(void *p)
 {
 	return (GDK_DISPLAY(p));
 }
 
+static int text_width(GtkWidget *widget, const char *text, gboolean markup)
+{
+	int width, height;
+	PangoLayout *layout = gtk_widget_create_pango_layout(widget, NULL);
+	if (markup) {
+		pango_layout_set_markup(layout, text, -1);
+	} else {
+		pango_layout_set_text(layout, text, -1);
+	}
+	pango_layout_get_pixel_size(layout, &width, &height);
+	g_object_unref(layout);
+
+	GtkStyleContext *context = gtk_widget_get_style_context(widget);
+	GtkStateFlags state = gtk_style_context_get_state(context);
+	GtkBorder padding, border;
+	gtk_style_context_get_padding(context, state, &padding);
+	gtk_style_context_get_border(context, state, &border);
+
+	return width + padding.left + padding.right + border.left + border.right;
+}
+
+static GdkEvent * menu_trigger(GtkWidget *widget)
+{
+	GdkEvent *event = gtk_get_current_event();
+	GdkWindow *window = gtk_widget_get_window(widget);
+	if (event != NULL || window == NULL) {
+		return event;
+	}
+
+	// menus opened with open-menu have no event, so make up a click on
+	// the widget for the menu to grab the pointer with
+	GdkSeat *seat = gdk_display_get_default_seat(gtk_widget_get_display(widget));
+	event = gdk_event_new(GDK_BUTTON_PRESS);
+	event->button.window = g_object_ref(window);
+	event->button.send_event = TRUE;
+	event->button.time = GDK_CURRENT_TIME;
+	event->button.button = GDK_BUTTON_PRIMARY;
+	gdk_event_set_device(event, gdk_seat_get_pointer(seat));
+	return event;
+}
+
 void set_strut_properties(GtkWindow *window,
 				long left, long right, long top, long bottom,
  				long left_start_y, long left_end_y,
@@ -53,6 +100,7 @@ void set_strut_properties(GtkWindow *window,
 */
 import "C"
 import (
+	"strings"
 	"sync"
 	"unsafe"
 
@@ -115,7 +163,34 @@ func updateDimensions(window *gtk.Window, bar *gtk.Widget) error {
 	return nil
 }
 
-func popupMenuAt(widget *gtk.Widget, menu *gtk.Menu) {
+func setVertical(widget *gtk.Widget) {
+	widgetPointer := unsafe.Pointer(widget.GObject)
+	C.gtk_orientable_set_orientation(C.toGtkOrientable(widgetPointer), C.GTK_ORIENTATION_VERTICAL)
+}
+
+// menuTrigger is a copy of the event that opened a menu. Menus need it to
+// grab the pointer and keyboard, and menus built by a command pop up after
+// the event has been handled.
+type menuTrigger struct {
+	event *C.GdkEvent
+}
+
+// currentMenuTrigger copies the event gtk is handling for a menu that pops
+// up at widget. It must be called on the gtk thread.
+func currentMenuTrigger(widget *gtk.Widget) *menuTrigger {
+	widgetPointer := unsafe.Pointer(widget.GObject)
+	return &menuTrigger{event: C.menu_trigger(C.toGtkWidget(widgetPointer))}
+}
+
+// free releases the copy of the event.
+func (t *menuTrigger) free() {
+	if t.event != nil {
+		C.gdk_event_free(t.event)
+		t.event = nil
+	}
+}
+
+func popupMenuAt(widget *gtk.Widget, menu *gtk.Menu, trigger *menuTrigger) {
 	menuPointer := unsafe.Pointer(menu.GObject)
 	gtkMenu := C.toGtkMenu(menuPointer)
 
@@ -127,10 +202,61 @@ func popupMenuAt(widget *gtk.Widget, menu *gtk.Menu) {
 		gtkWidget,
 		C.GDK_GRAVITY_SOUTH_WEST,
 		C.GDK_GRAVITY_NORTH_WEST,
-		nil,
+		trigger.event,
 	)
 }
 
+// popupPopoverAt opens a popover below widget, like popupMenuAt does for
+// menus.
+func popupPopoverAt(widget *gtk.Widget, popover *gtk.Popover) {
+	popover.SetRelativeTo(widget)
+	popover.SetPosition(gtk.POS_BOTTOM)
+	popover.Popup()
+}
+
+// textWidth returns the width the widget needs to show text with its
+// current font, padding and border.
+func textWidth(widget *gtk.Widget, text string) int {
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+
+	widgetPointer := unsafe.Pointer(widget.GObject)
+	return int(C.text_width(C.toGtkWidget(widgetPointer), cText, C.FALSE))
+}
+
+// markupWidth is like textWidth for Pango markup.
+func markupWidth(widget *gtk.Widget, markup string) int {
+	cMarkup := C.CString(markup)
+	defer C.free(unsafe.Pointer(cMarkup))
+
+	widgetPointer := unsafe.Pointer(widget.GObject)
+	return int(C.text_width(C.toGtkWidget(widgetPointer), cMarkup, C.TRUE))
+}
+
+func triggerTooltipQuery(widget *gtk.Widget) {
+	widgetPointer := unsafe.Pointer(widget.GObject)
+	C.gtk_widget_trigger_tooltip_query(C.toGtkWidget(widgetPointer))
+}
+
+func isValidMarkup(markup string) bool {
+	cMarkup := C.CString(markup)
+	defer C.free(unsafe.Pointer(cMarkup))
+
+	return C.pango_parse_markup(cMarkup, -1, 0, nil, nil, nil, nil) != 0
+}
+
+var markupEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"'", "&#39;",
+	"\"", "&quot;",
+)
+
+func escapeMarkup(text string) string {
+	return markupEscaper.Replace(text)
+}
+
 func enableTransparency(window *gtk.Window) error {
 	screen := window.GetScreen()
 	if screen == nil {
@@ -158,6 +284,15 @@ func applyClass(widget *gtk.Widget, class string) error {
 	return nil
 }
 
+func removeClass(widget *gtk.Widget, class string) error {
+	styleContext, err := widget.GetStyleContext()
+	if err != nil {
+		return err
+	}
+	styleContext.RemoveClass(class)
+	return nil
+}
+
 func executeGtkSync(f func() error) error {
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -0,0 +1,6 @@
+package main
+
+// Hide contains the arguments used for the hide command.
+type Hide struct {
+	Name string
+}
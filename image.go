@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+func (b *Block) initializeImage() error {
+	return executeGtkSync(func() error {
+		image, err := gtk.ImageNew()
+		if err != nil {
+			return err
+		}
+		b.Image = image
+		b.box.PackStart(image, false, false, 0)
+		b.box.ReorderChild(image, 0)
+
+		err = applyClass(&image.Widget, "image")
+		if err != nil {
+			return err
+		}
+
+		b.updateImage()
+		return nil
+	})
+}
+
+// updateImage shows the icon or image from the last output, falling back
+// to the IconName or ImagePath of the block. It must be called on the gtk
+// thread.
+func (b *Block) updateImage() {
+	iconName, imagePath := b.outputIcon, b.outputImage
+	if iconName == "" && imagePath == "" {
+		iconName, imagePath = b.IconName, b.ImagePath
+	}
+
+	// commands repeat the same icon on every update, so only load it when
+	// it changes
+	if b.imageLoaded && iconName == b.shownIcon && imagePath == b.shownImage {
+		return
+	}
+	b.imageLoaded = true
+	b.shownIcon, b.shownImage = iconName, imagePath
+
+	switch {
+	case iconName != "":
+		b.Image.SetFromIconName(iconName, gtk.ICON_SIZE_BUTTON)
+		b.Image.SetPixelSize(b.IconSize)
+	case imagePath != "":
+		pixbuf, err := gdk.PixbufNewFromFileAtScale(expandHome(imagePath), b.IconSize, b.IconSize, true)
+		if err != nil {
+			log.Printf("Couldn't load image %s: %v", imagePath, err)
+			b.Image.Clear()
+		} else {
+			b.Image.SetFromPixbuf(pixbuf)
+		}
+	default:
+		b.Image.Clear()
+	}
+
+	b.Image.SetVisible(iconName != "" || imagePath != "")
+}
+
+// parseImage splits "icon:NAME TEXT" or "image:PATH TEXT" into the icon
+// name or image path and the text.
+func parseImage(line string) (iconName string, imagePath string, text string) {
+	for _, prefix := range []string{"icon:", "image:"} {
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+
+		value := strings.TrimPrefix(line, prefix)
+		if i := strings.IndexAny(value, " \t"); i >= 0 {
+			value, text = value[:i], strings.TrimSpace(value[i:])
+		}
+		if prefix == "icon:" {
+			return value, "", text
+		}
+		return "", value, text
+	}
+	return "", "", line
+}
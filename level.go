@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// levelClasses are the threshold classes added to level blocks.
+var levelClasses = []string{"low", "high", "critical"}
+
+// initializeLevel replaces the label of level blocks with a gtk.LevelBar
+// showing the value from the command output.
+func (b *Block) initializeLevel() error {
+	if b.Type != "level" {
+		return nil
+	}
+
+	return executeGtkSync(func() error {
+		levelBar, err := gtk.LevelBarNewForInterval(b.Min, b.Max)
+		if err != nil {
+			return err
+		}
+		b.levelBar = levelBar
+		// the default offsets would style most values as "high" or "full",
+		// whatever the thresholds of the block say
+		for _, offset := range []string{gtk.LEVEL_BAR_OFFSET_LOW, gtk.LEVEL_BAR_OFFSET_HIGH, gtk.LEVEL_BAR_OFFSET_FULL} {
+			levelBar.RemoveOffsetValue(offset)
+		}
+
+		if b.Vertical {
+			setVertical(&levelBar.Widget)
+			// fill from the bottom up
+			levelBar.SetInverted(true)
+			levelBar.SetSizeRequest(-1, 20)
+		} else {
+			levelBar.SetSizeRequest(60, -1)
+		}
+		levelBar.SetVAlign(gtk.ALIGN_CENTER)
+
+		err = applyClass(&levelBar.Widget, "level")
+		if err != nil {
+			return err
+		}
+
+		b.Label.Hide()
+		b.box.PackStart(levelBar, true, true, 0)
+		levelBar.Show()
+
+		b.updateLevel(Output{Text: b.Text})
+		return nil
+	})
+}
+
+// updateLevel shows the value from output. It must be called on the gtk
+// thread.
+func (b *Block) updateLevel(output Output) {
+	value, ok := output.value()
+	if !ok {
+		value = b.Min
+	}
+	b.levelBar.SetValue(value)
+
+	levelClass := b.levelClass(value)
+	for _, class := range levelClasses {
+		if class == levelClass {
+			applyClass(&b.levelBar.Widget, class)
+		} else {
+			removeClass(&b.levelBar.Widget, class)
+		}
+	}
+}
+
+// levelClass returns the threshold class for value. Unset thresholds are
+// NaN, which never matches. Critical applies below the threshold when it's
+// in the lower half of the range, like a battery, and above it otherwise,
+// like disk usage.
+func (b *Block) levelClass(value float64) string {
+	if b.Critical <= (b.Min+b.Max)/2 {
+		if value <= b.Critical {
+			return "critical"
+		}
+	} else if value >= b.Critical {
+		return "critical"
+	}
+
+	if value <= b.Low {
+		return "low"
+	}
+	if value >= b.High {
+		return "high"
+	}
+	return ""
+}
@@ -24,7 +24,13 @@ const (
 var (
 	app = kingpin.New("vbar", "A bar.")
 
-	commandStart = app.Command("start", "Start vbar.")
+	commandStart         = app.Command("start", "Start vbar.")
+	flagStartShell       = commandStart.Flag("shell", "Shell used to execute commands.").Default("bash").String()
+	flagStartNice        = optionalIntFlag(commandStart.Flag("nice", "Niceness of commands."))
+	flagStartIONice      = commandStart.Flag("ionice", "IO scheduling class of commands.").Enum("none", "idle", "best-effort", "realtime")
+	flagStartMemoryLimit = commandStart.Flag("memory-limit", "Maximum memory a command can use, like 100MB.").Bytes()
+	flagStartCPULimit    = commandStart.Flag("cpu-limit", "Maximum CPU time a command can use, like 10s.").Duration()
+	flagStartMaxOutput   = commandStart.Flag("max-output", "Maximum output read from a command, like 64KB.").Bytes()
 
 	commandAddCSS   = app.Command("add-css", "Add CSS.")
 	flagAddCSSClass = commandAddCSS.Flag("class", "CSS Class name.").Required().String()
@@ -36,24 +42,125 @@ var (
 	flagAddBlockCenter       = commandAddBlock.Flag("center", "Add block to the center.").Bool()
 	flagAddBlockRight        = commandAddBlock.Flag("right", "Add block to the right.").Bool()
 	flagAddBlockText         = commandAddBlock.Flag("text", "Block text.").String()
+	flagAddBlockMarkup       = commandAddBlock.Flag("markup", "Use Pango markup in the block text.").Bool()
+	flagAddBlockTooltip      = commandAddBlock.Flag("tooltip", "Tooltip text.").String()
+	flagAddBlockTooltipCmd   = commandAddBlock.Flag("tooltip-command", "Command to execute for the tooltip text.").String()
 	flagAddBlockCommand      = commandAddBlock.Flag("command", "Command to execute.").String()
 	flagAddBlockTailCommand  = commandAddBlock.Flag("tail-command", "Command to tail.").String()
-	flagAddBlockInterval     = commandAddBlock.Flag("interval", "Interval in seconds to execute command.").Int()
+	flagAddBlockPriority     = commandAddBlock.Flag("priority", "Blocks with a lower priority are shortened or hidden first when the bar is full.").Int()
+	flagAddBlockMinWidth     = commandAddBlock.Flag("min-width", "Minimum width in characters, pixels like 120px, or a sample string.").String()
+	flagAddBlockMaxWidth     = commandAddBlock.Flag("max-width", "Maximum width in characters.").Int()
+	flagAddBlockOverflow     = commandAddBlock.Flag("overflow", "How to shorten text longer than --max-width.").Default("ellipsize").Enum("ellipsize", "truncate")
+	flagAddBlockTextAlign    = commandAddBlock.Flag("text-align", "Alignment of the text within the block.").Enum("left", "center", "right")
+	flagAddBlockScroll       = commandAddBlock.Flag("scroll", "Scroll text longer than --max-width.").Bool()
+	flagAddBlockScrollSpeed  = commandAddBlock.Flag("scroll-speed", "Scrolling speed in pixels per second.").Default("30").Float64()
+	flagAddBlockHideEmpty    = commandAddBlock.Flag("hide-empty", "Hide the block when its text is empty.").Bool()
+	flagAddBlockCompanion    = commandAddBlock.Flag("companion", "Block that is hidden along with this block.").String()
+	flagAddBlockImage        = commandAddBlock.Flag("image", "Path of an image to show next to the text.").String()
+	flagAddBlockIcon         = commandAddBlock.Flag("icon", "Name of an icon from the icon theme to show next to the text.").String()
+	flagAddBlockIconSize     = commandAddBlock.Flag("icon-size", "Size of the image or icon in pixels.").Default("16").Int()
+	flagAddBlockType         = commandAddBlock.Flag("type", "Type of block.").Default("text").Enum("text", "level", "graph")
+	flagAddBlockMin          = commandAddBlock.Flag("min", "Minimum value of a level or graph block.").Default("0").Float64()
+	flagAddBlockMax          = commandAddBlock.Flag("max", "Maximum value of a level or graph block.").Default("100").Float64()
+	flagAddBlockVertical     = commandAddBlock.Flag("vertical", "Draw a vertical level block.").Bool()
+	flagAddBlockLow          = commandAddBlock.Flag("low", "Values up to this get the low class.").Default("NaN").Float64()
+	flagAddBlockHigh         = commandAddBlock.Flag("high", "Values from this get the high class.").Default("NaN").Float64()
+	flagAddBlockCritical     = commandAddBlock.Flag("critical", "Values past this get the critical class.").Default("NaN").Float64()
+	flagAddBlockGraphSize    = commandAddBlock.Flag("graph-size", "Number of values shown by a graph block.").Default("30").Int()
+	flagAddBlockGraphStyle   = commandAddBlock.Flag("graph-style", "Draw a graph block as a line or a filled area.").Default("line").Enum("line", "area")
+	flagAddBlockAutoScale    = commandAddBlock.Flag("auto-scale", "Scale a graph block to the values it shows instead of --max.").Bool()
+	flagAddBlockJSON         = commandAddBlock.Flag("json", "Command output is JSON.").Bool()
+	flagAddBlockInterval     = commandAddBlock.Flag("interval", "Interval to execute command, in seconds or as a duration like 500ms.").String()
+	flagAddBlockAlign        = commandAddBlock.Flag("align", "Align the interval to the wall clock.").Bool()
+	flagAddBlockSchedule     = commandAddBlock.Flag("schedule", "Cron expression to execute command on.").String()
+	flagAddBlockOnError      = commandAddBlock.Flag("on-error", "What to show when command fails.").Default("keep").Enum("keep", "text", "hide")
+	flagAddBlockErrorText    = commandAddBlock.Flag("error-text", "Text to show when command fails with --on-error text.").Default("ERROR").String()
+	flagAddBlockUrgentCode   = commandAddBlock.Flag("urgent-code", "Exit code that marks the block as urgent.").Default("33").Int()
+	flagAddBlockHideCode     = commandAddBlock.Flag("hide-code", "Exit code that hides the block.").Int()
+	flagAddBlockFlashBar     = commandAddBlock.Flag("flash-bar", "Flash the bar while the block is urgent.").Bool()
+	flagAddBlockSignal       = commandAddBlock.Flag("signal", "Execute command when vbar receives SIGRTMIN+N.").Int()
 	flagAddBlockClickCommand = commandAddBlock.Flag("click-command", "Command to execute when clicking on the block.").String()
+	flagAddBlockExec         = commandAddBlock.Flag("exec", "Execute commands directly instead of with the shell.").Bool()
+	flagAddBlockDir          = commandAddBlock.Flag("dir", "Working directory for commands.").String()
+	flagAddBlockNice         = optionalIntFlag(commandAddBlock.Flag("nice", "Niceness of commands."))
+	flagAddBlockIONice       = commandAddBlock.Flag("ionice", "IO scheduling class of commands.").Enum("none", "idle", "best-effort", "realtime")
+	flagAddBlockMemoryLimit  = commandAddBlock.Flag("memory-limit", "Maximum memory a command can use, like 100MB.").Bytes()
+	flagAddBlockCPULimit     = commandAddBlock.Flag("cpu-limit", "Maximum CPU time a command can use, like 10s.").Duration()
+	flagAddBlockMaxOutput    = commandAddBlock.Flag("max-output", "Maximum output read from a command, like 64KB.").Bytes()
+	flagAddBlockRestart      = commandAddBlock.Flag("restart", "When to restart the tail command after it exits.").Default("never").Enum("always", "on-failure", "never")
+	flagAddBlockRestartDelay = commandAddBlock.Flag("restart-delay", "Delay before first restarting the tail command.").Default("1s").Duration()
+	flagAddBlockRestartMax   = commandAddBlock.Flag("restart-max-delay", "Maximum delay between tail command restarts.").Default("1m").Duration()
+	flagAddBlockMenuCommand  = commandAddBlock.Flag("menu-command", "Command whose output builds the menu every time it opens.").String()
+	flagAddBlockMenuButton   = commandAddBlock.Flag("menu-button", "Mouse button that opens the menu.").Enum("left", "middle", "right")
+	flagAddBlockFlashChange  = commandAddBlock.Flag("flash-on-change", "Add the changed class for this long when the text changes.").Duration()
+	flagAddBlockBlink        = commandAddBlock.Flag("blink", "Toggle the blink class while the block is urgent.").Bool()
+	flagAddBlockFormat       = commandAddBlock.Flag("format", "Template that formats the command or source output.").String()
+	flagAddBlockSource       = commandAddBlock.Flag("source", "Source to render the block from.").String()
+	flagAddBlockTooltipTmpl  = commandAddBlock.Flag("tooltip-template", "Template that renders the tooltip from the source output.").String()
 
-	commandAddMenu       = app.Command("add-menu", "Add a menu to a block.")
-	flagAddMenuBlockName = commandAddMenu.Flag("name", "Block name.").Required().String()
-	flagAddMenuText      = commandAddMenu.Flag("text", "Menu text.").Required().String()
-	flagAddMenuCommand   = commandAddMenu.Flag("command", "Command to execute when activating the menu.").Required().String()
+	commandAddSource      = app.Command("add-source", "Add a source that feeds several blocks.")
+	flagAddSourceName     = commandAddSource.Flag("name", "Source name.").Required().String()
+	flagAddSourceCommand  = commandAddSource.Flag("command", "Command to execute.").Required().String()
+	flagAddSourceInterval = commandAddSource.Flag("interval", "Interval to execute command, in seconds or as a duration like 500ms.").String()
+	flagAddSourceAlign    = commandAddSource.Flag("align", "Align the interval to the wall clock.").Bool()
+	flagAddSourceSchedule = commandAddSource.Flag("schedule", "Cron expression to execute command on.").String()
+
+	commandAddMenu          = app.Command("add-menu", "Add a menu to a block.")
+	flagAddMenuBlockName    = commandAddMenu.Flag("name", "Block name.").Required().String()
+	flagAddMenuText         = commandAddMenu.Flag("text", "Menu text.").String()
+	flagAddMenuCommand      = commandAddMenu.Flag("command", "Command to execute when activating the menu.").String()
+	flagAddMenuParent       = commandAddMenu.Flag("parent", "Text of the menu item to add a submenu item to.").String()
+	flagAddMenuSeparator    = commandAddMenu.Flag("separator", "Add a separator.").Bool()
+	flagAddMenuCheck        = commandAddMenu.Flag("check", "Add a check item.").Bool()
+	flagAddMenuRadio        = commandAddMenu.Flag("radio", "Add a radio item to the named group.").String()
+	flagAddMenuStateCommand = commandAddMenu.Flag("state-command", "Command that exits with code 0 when the check or radio item is active.").String()
+	flagAddMenuID           = commandAddMenu.Flag("id", "ID used to edit or remove the item.").String()
+
+	commandRemoveMenu       = app.Command("remove-menu", "Remove an item from the menu of a block.")
+	flagRemoveMenuBlockName = commandRemoveMenu.Flag("name", "Block name.").Required().String()
+	flagRemoveMenuText      = commandRemoveMenu.Flag("text", "Menu text.").String()
+	flagRemoveMenuID        = commandRemoveMenu.Flag("id", "Menu item ID.").String()
+
+	commandClearMenu       = app.Command("clear-menu", "Remove every item from the menu of a block.")
+	flagClearMenuBlockName = commandClearMenu.Flag("name", "Block name.").Required().String()
+
+	commandEditMenu       = app.Command("edit-menu", "Change an item in the menu of a block.")
+	flagEditMenuBlockName = commandEditMenu.Flag("name", "Block name.").Required().String()
+	flagEditMenuID        = commandEditMenu.Flag("id", "Menu item ID.").Required().String()
+	flagEditMenuText      = commandEditMenu.Flag("text", "New menu text.").String()
+	flagEditMenuEnable    = commandEditMenu.Flag("enable", "Enable the item.").Bool()
+	flagEditMenuDisable   = commandEditMenu.Flag("disable", "Disable the item.").Bool()
+	flagEditMenuPosition  = commandEditMenu.Flag("position", "Move the item to this position in its menu, starting at 0.").Default("-1").Int()
+
+	commandOpenMenu       = app.Command("open-menu", "Open the menu or popover of a block.")
+	flagOpenMenuBlockName = commandOpenMenu.Flag("name", "Block name.").Required().String()
+
+	commandAddPopover        = app.Command("add-popover", "Add an item to the popover of a block.")
+	flagAddPopoverBlockName  = commandAddPopover.Flag("name", "Block name.").Required().String()
+	flagAddPopoverType       = commandAddPopover.Flag("type", "Item type.").Default("label").Enum("label", "slider", "toggle", "button", "calendar")
+	flagAddPopoverText       = commandAddPopover.Flag("text", "Item text.").String()
+	flagAddPopoverCommand    = commandAddPopover.Flag("command", "Command run by buttons and calendars, or shown by labels.").String()
+	flagAddPopoverGetCommand = commandAddPopover.Flag("get-command", "Command that reads the slider or toggle state.").String()
+	flagAddPopoverSetCommand = commandAddPopover.Flag("set-command", "Command that sets the slider or toggle state, {} is replaced by the value.").String()
+	flagAddPopoverMin        = commandAddPopover.Flag("min", "Minimum slider value.").Default("0").Float64()
+	flagAddPopoverMax        = commandAddPopover.Flag("max", "Maximum slider value.").Default("100").Float64()
+	flagAddPopoverStep       = commandAddPopover.Flag("step", "Slider step.").Default("1").Float64()
 
 	commandUpdate       = app.Command("update", "Trigger a block update.")
 	flagUpdateBlockName = commandUpdate.Flag("name", "Block name.").Required().String()
 
+	commandShow       = app.Command("show", "Show a hidden block.")
+	flagShowBlockName = commandShow.Flag("name", "Block name.").Required().String()
+
+	commandHide       = app.Command("hide", "Hide a block.")
+	flagHideBlockName = commandHide.Flag("name", "Block name.").Required().String()
+
 	commandRemove       = app.Command("remove", "Remove a block.")
 	flagRemoveBlockName = commandRemove.Flag("name", "Block name.").Required().String()
 
-	window *Window
-	mutex  = &sync.Mutex{}
+	window    *Window
+	scheduler *Scheduler
+	mutex     = &sync.Mutex{}
 )
 
 func main() {
@@ -72,26 +179,160 @@ func main() {
 		err := rpcClient("Command.AddBlock", &AddBlock{
 			Name:         *flagAddBlockName,
 			Text:         *flagAddBlockText,
+			Markup:       *flagAddBlockMarkup,
 			Left:         *flagAddBlockLeft,
 			Center:       *flagAddBlockCenter,
 			Right:        *flagAddBlockRight,
 			Command:      *flagAddBlockCommand,
 			TailCommand:  *flagAddBlockTailCommand,
+			JSON:         *flagAddBlockJSON,
 			Interval:     *flagAddBlockInterval,
+			Align:        *flagAddBlockAlign,
+			Schedule:     *flagAddBlockSchedule,
+			Signal:       *flagAddBlockSignal,
+			OnError:      *flagAddBlockOnError,
+			ErrorText:    *flagAddBlockErrorText,
+			UrgentCode:   *flagAddBlockUrgentCode,
+			HideCode:     *flagAddBlockHideCode,
+			FlashBar:     *flagAddBlockFlashBar,
 			ClickCommand: *flagAddBlockClickCommand,
+			Exec:         *flagAddBlockExec,
+			Dir:          *flagAddBlockDir,
+			Limits: Limits{
+				Nice:        flagAddBlockNice.value,
+				IONice:      *flagAddBlockIONice,
+				MemoryLimit: int64(*flagAddBlockMemoryLimit),
+				CPULimit:    *flagAddBlockCPULimit,
+				MaxOutput:   int64(*flagAddBlockMaxOutput),
+			},
+
+			Tooltip:        *flagAddBlockTooltip,
+			TooltipCommand: *flagAddBlockTooltipCmd,
+
+			Priority: *flagAddBlockPriority,
+
+			MinWidth:  *flagAddBlockMinWidth,
+			MaxWidth:  *flagAddBlockMaxWidth,
+			Overflow:  *flagAddBlockOverflow,
+			TextAlign: *flagAddBlockTextAlign,
+
+			Scroll:      *flagAddBlockScroll,
+			ScrollSpeed: *flagAddBlockScrollSpeed,
+
+			HideEmpty: *flagAddBlockHideEmpty,
+			Companion: *flagAddBlockCompanion,
+
+			ImagePath: *flagAddBlockImage,
+			IconName:  *flagAddBlockIcon,
+			IconSize:  *flagAddBlockIconSize,
+
+			Type:     *flagAddBlockType,
+			Min:      *flagAddBlockMin,
+			Max:      *flagAddBlockMax,
+			Vertical: *flagAddBlockVertical,
+			Low:      *flagAddBlockLow,
+			High:     *flagAddBlockHigh,
+			Critical: *flagAddBlockCritical,
+
+			GraphSize:  *flagAddBlockGraphSize,
+			GraphStyle: *flagAddBlockGraphStyle,
+			AutoScale:  *flagAddBlockAutoScale,
+
+			Restart:         *flagAddBlockRestart,
+			RestartDelay:    *flagAddBlockRestartDelay,
+			RestartMaxDelay: *flagAddBlockRestartMax,
+
+			MenuCommand: *flagAddBlockMenuCommand,
+			MenuButton:  *flagAddBlockMenuButton,
+
+			FlashOnChange: *flagAddBlockFlashChange,
+			Blink:         *flagAddBlockBlink,
+
+			Format: *flagAddBlockFormat,
+
+			Source:          *flagAddBlockSource,
+			TooltipTemplate: *flagAddBlockTooltipTmpl,
 		})
 		if err != nil {
 			log.Panicf("add-block err %v", err)
 		}
+	case commandAddSource.FullCommand():
+		err := rpcClient("Command.AddSource", &AddSource{
+			Name:     *flagAddSourceName,
+			Command:  *flagAddSourceCommand,
+			Interval: *flagAddSourceInterval,
+			Align:    *flagAddSourceAlign,
+			Schedule: *flagAddSourceSchedule,
+		})
+		if err != nil {
+			log.Panicf("add-source err %v", err)
+		}
 	case commandAddMenu.FullCommand():
 		err := rpcClient("Command.AddMenu", &AddMenu{
 			Name:    *flagAddMenuBlockName,
 			Text:    *flagAddMenuText,
 			Command: *flagAddMenuCommand,
+
+			Parent:       *flagAddMenuParent,
+			Separator:    *flagAddMenuSeparator,
+			Check:        *flagAddMenuCheck,
+			Radio:        *flagAddMenuRadio,
+			StateCommand: *flagAddMenuStateCommand,
+			ID:           *flagAddMenuID,
 		})
 		if err != nil {
 			log.Panicf("add-menu err %v", err)
 		}
+	case commandRemoveMenu.FullCommand():
+		err := rpcClient("Command.RemoveMenu", &RemoveMenu{
+			Name: *flagRemoveMenuBlockName,
+			Text: *flagRemoveMenuText,
+			ID:   *flagRemoveMenuID,
+		})
+		if err != nil {
+			log.Panicf("remove-menu err %v", err)
+		}
+	case commandClearMenu.FullCommand():
+		err := rpcClient("Command.ClearMenu", &ClearMenu{
+			Name: *flagClearMenuBlockName,
+		})
+		if err != nil {
+			log.Panicf("clear-menu err %v", err)
+		}
+	case commandEditMenu.FullCommand():
+		err := rpcClient("Command.EditMenu", &EditMenu{
+			Name:     *flagEditMenuBlockName,
+			ID:       *flagEditMenuID,
+			Text:     *flagEditMenuText,
+			Enable:   *flagEditMenuEnable,
+			Disable:  *flagEditMenuDisable,
+			Position: *flagEditMenuPosition,
+		})
+		if err != nil {
+			log.Panicf("edit-menu err %v", err)
+		}
+	case commandOpenMenu.FullCommand():
+		err := rpcClient("Command.OpenMenu", &OpenMenu{
+			Name: *flagOpenMenuBlockName,
+		})
+		if err != nil {
+			log.Panicf("open-menu err %v", err)
+		}
+	case commandAddPopover.FullCommand():
+		err := rpcClient("Command.AddPopover", &AddPopover{
+			Name:       *flagAddPopoverBlockName,
+			Type:       *flagAddPopoverType,
+			Text:       *flagAddPopoverText,
+			Command:    *flagAddPopoverCommand,
+			GetCommand: *flagAddPopoverGetCommand,
+			SetCommand: *flagAddPopoverSetCommand,
+			Min:        *flagAddPopoverMin,
+			Max:        *flagAddPopoverMax,
+			Step:       *flagAddPopoverStep,
+		})
+		if err != nil {
+			log.Panicf("add-popover err %v", err)
+		}
 	case commandUpdate.FullCommand():
 		err := rpcClient("Command.Update", &Update{
 			Name: *flagUpdateBlockName,
@@ -99,6 +340,20 @@ func main() {
 		if err != nil {
 			log.Panicf("update err %v", err)
 		}
+	case commandShow.FullCommand():
+		err := rpcClient("Command.Show", &Show{
+			Name: *flagShowBlockName,
+		})
+		if err != nil {
+			log.Panicf("show err %v", err)
+		}
+	case commandHide.FullCommand():
+		err := rpcClient("Command.Hide", &Hide{
+			Name: *flagHideBlockName,
+		})
+		if err != nil {
+			log.Panicf("hide err %v", err)
+		}
 	case commandRemove.FullCommand():
 		err := rpcClient("Command.Remove", &Remove{
 			Name: *flagRemoveBlockName,
@@ -110,6 +365,18 @@ func main() {
 }
 
 func launch() {
+	err := setShell(*flagStartShell)
+	if err != nil {
+		log.Panic(err)
+	}
+	limits = Limits{
+		Nice:        flagStartNice.value,
+		IONice:      *flagStartIONice,
+		MemoryLimit: int64(*flagStartMemoryLimit),
+		CPULimit:    *flagStartCPULimit,
+		MaxOutput:   int64(*flagStartMaxOutput),
+	}
+
 	gtk.Init(nil)
 
 	w, err := WindowNew()
@@ -118,6 +385,8 @@ func launch() {
 	}
 	window = w
 
+	scheduler = SchedulerNew()
+
 	control := make(chan int)
 	// create command listener
 	go func() {
@@ -148,17 +417,25 @@ func launch() {
 
 	// add signal handler for proper close
 	go func() {
-		c := make(chan os.Signal, 1)
-
-		signal.Notify(c, os.Interrupt, syscall.SIGABRT)
-		<-c
-		// stops all gorotines wating control
-		close(control)
-		// close qtk app
-		gtk.MainQuit()
+		signal.Notify(signals, os.Interrupt, syscall.SIGABRT, syscall.SIGTERM)
+		for sig := range signals {
+			// blocks can ask to be updated on SIGRTMIN+N
+			if n, ok := blockSignalNumber(sig); ok {
+				window.signalBlocks(n)
+				continue
+			}
+			// stops all gorotines wating control
+			close(control)
+			// close qtk app
+			gtk.MainQuit()
+			return
+		}
 	}()
 
 	gtk.Main()
+
+	// don't leave tail commands running without a bar
+	processes.KillAll()
 }
 
 func rpcClient(command string, args interface{}) (err error) {
@@ -186,7 +463,7 @@ func executeConfig() error {
 	}
 	configurationFilePath := path.Join(configurationDirectory, "vbar", "vbarrc")
 
-	cmd := exec.Command("/bin/bash", "-c", configurationFilePath)
+	cmd := exec.Command(shell, "-c", configurationFilePath)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// MenuItem is a single item in the menu of a block.
+type MenuItem struct {
+	AddMenu
+	item *gtk.MenuItem
+	// check is set for check and radio items
+	check   *gtk.CheckMenuItem
+	radio   *gtk.RadioMenuItem
+	submenu *gtk.Menu
+	// menu is the menu the item is in, and parent the item owning it
+	menu   *gtk.Menu
+	parent *MenuItem
+}
+
+// initializeMenu creates the menu of a block. It must be called on the gtk
+// thread.
+func (b *Block) initializeMenu() error {
+	menu, err := b.newMenu()
+	if err != nil {
+		return err
+	}
+	b.Menu = menu
+	b.radioGroups = map[string]*gtk.RadioMenuItem{}
+	return nil
+}
+
+// initializeMenuCommand creates the menu of blocks with a menu command, so
+// that it opens even before any item is added with add-menu.
+func (b *Block) initializeMenuCommand() error {
+	if b.MenuCommand == "" {
+		return nil
+	}
+	return executeGtkSync(b.initializeMenu)
+}
+
+// openMenu pops up the menu, after rebuilding it from the output of the
+// menu command. It must be called on the gtk thread.
+func (b *Block) openMenu() {
+	b.refreshMenu()
+	trigger := currentMenuTrigger(&b.EventBox.Widget)
+	if b.MenuCommand == "" {
+		popupMenuAt(&b.EventBox.Widget, b.Menu, trigger)
+		trigger.free()
+		return
+	}
+
+	go func() {
+		entries, err := b.menuEntries()
+		if err != nil {
+			log.Printf("Can't build menu: %v", err)
+		}
+		executeGtkSync(func() error {
+			b.rebuildMenu(entries)
+			if err != nil {
+				b.addMenuError(err)
+			}
+			popupMenuAt(&b.EventBox.Widget, b.Menu, trigger)
+			trigger.free()
+			return nil
+		})
+	}()
+}
+
+// menuEntries runs the menu command and parses its output.
+func (b *Block) menuEntries() ([]MenuEntry, error) {
+	output, err := b.runner(b.MenuCommand).Output()
+	if err != nil {
+		return nil, fmt.Errorf("menu command finished with error: %v", err)
+	}
+	entries, err := parseMenu(string(output))
+	if err != nil {
+		return nil, fmt.Errorf("can't parse menu command output: %v", err)
+	}
+	return entries, nil
+}
+
+// addMenuError adds an insensitive item below the static items saying why
+// the menu command failed. It must be called on the gtk thread.
+func (b *Block) addMenuError(err error) {
+	item, itemErr := gtk.MenuItemNewWithLabel(err.Error())
+	if itemErr != nil {
+		log.Printf("Can't add menu error: %v", itemErr)
+		return
+	}
+	item.SetSensitive(false)
+	b.Menu.Append(item)
+	item.Show()
+	b.dynamicMenu = append(b.dynamicMenu, item)
+}
+
+func (b *Block) newMenu() (*gtk.Menu, error) {
+	menu, err := gtk.MenuNew()
+	if err != nil {
+		return nil, err
+	}
+	err = applyClass(&menu.Widget, "menu")
+	if err != nil {
+		return nil, err
+	}
+	return menu, nil
+}
+
+// addMenuItem adds an item to the menu, or to the submenu of its parent.
+// It must be called on the gtk thread.
+func (b *Block) addMenuItem(addMenu AddMenu) error {
+	if !addMenu.Separator && addMenu.Text == "" {
+		return fmt.Errorf("menu items need --text")
+	}
+	if addMenu.ID != "" && b.findMenuItemByID(addMenu.ID) != nil {
+		return fmt.Errorf("menu item %s already exists", addMenu.ID)
+	}
+
+	var parent *MenuItem
+	if addMenu.Parent != "" {
+		parent = b.findMenuItem(addMenu.Parent)
+		if parent == nil {
+			// create the parent so that submenus can be added in one go
+			var err error
+			parent, err = b.newMenuItem(nil, AddMenu{Text: addMenu.Parent})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := b.newMenuItem(parent, addMenu)
+	return err
+}
+
+// newMenuItem creates an item and appends it to the submenu of parent, or
+// to the menu of the block when parent is nil.
+func (b *Block) newMenuItem(parent *MenuItem, addMenu AddMenu) (*MenuItem, error) {
+	item := &MenuItem{AddMenu: addMenu, menu: b.Menu, parent: parent}
+	if parent != nil {
+		submenu, err := parent.ensureSubmenu(b)
+		if err != nil {
+			return nil, err
+		}
+		item.menu = submenu
+	}
+
+	switch {
+	case addMenu.Separator:
+		separator, err := gtk.SeparatorMenuItemNew()
+		if err != nil {
+			return nil, err
+		}
+		item.item = &separator.MenuItem
+	case addMenu.Radio != "":
+		radio, err := gtk.RadioMenuItemNewWithLabelFromWidget(b.radioGroups[addMenu.Radio], addMenu.Text)
+		if err != nil {
+			return nil, err
+		}
+		if b.radioGroups[addMenu.Radio] == nil {
+			b.radioGroups[addMenu.Radio] = radio
+		}
+		item.radio = radio
+		item.check = &radio.CheckMenuItem
+		item.item = &radio.MenuItem
+	case addMenu.Check:
+		check, err := gtk.CheckMenuItemNewWithLabel(addMenu.Text)
+		if err != nil {
+			return nil, err
+		}
+		item.check = check
+		item.item = &check.MenuItem
+	default:
+		menuItem, err := gtk.MenuItemNewWithLabel(addMenu.Text)
+		if err != nil {
+			return nil, err
+		}
+		item.item = menuItem
+	}
+
+	if item.check != nil {
+		item.check.Connect("toggled", func() {
+			if b.menuUpdating {
+				return
+			}
+			active := item.check.GetActive()
+			// radio items are toggled off when another one is chosen
+			if item.Radio != "" && !active {
+				return
+			}
+			value := "off"
+			if active {
+				value = "on"
+			}
+			go b.runCommandWith(item.Command, value)
+		})
+	} else if !addMenu.Separator {
+		item.item.Connect("activate", func() {
+			go b.runCommand(item.Command)
+		})
+	}
+
+	item.menu.Add(item.item)
+	item.menu.ShowAll()
+	b.menuItems = append(b.menuItems, item)
+	return item, nil
+}
+
+// ensureSubmenu returns the submenu of the item, creating it if needed.
+func (item *MenuItem) ensureSubmenu(b *Block) (*gtk.Menu, error) {
+	if item.submenu != nil {
+		return item.submenu, nil
+	}
+	if item.check != nil || item.Separator {
+		return nil, fmt.Errorf("menu item %s can't have a submenu", item.Text)
+	}
+
+	submenu, err := b.newMenu()
+	if err != nil {
+		return nil, err
+	}
+	item.submenu = submenu
+	item.item.SetSubmenu(submenu)
+	return submenu, nil
+}
+
+func (b *Block) findMenuItem(text string) *MenuItem {
+	for _, item := range b.menuItems {
+		if item.Text == text && !item.Separator {
+			return item
+		}
+	}
+	return nil
+}
+
+func (b *Block) findMenuItemByID(id string) *MenuItem {
+	for _, item := range b.menuItems {
+		if item.ID == id {
+			return item
+		}
+	}
+	return nil
+}
+
+// removeMenuItem removes an item along with its submenu. It must be called
+// on the gtk thread.
+func (b *Block) removeMenuItem(removed *MenuItem) {
+	items := b.menuItems[:0]
+	for _, item := range b.menuItems {
+		if !item.descendantOf(removed) {
+			items = append(items, item)
+		}
+	}
+	b.menuItems = items
+
+	// radio items join their group through the first item of it, so pick
+	// another one if that is going away
+	for group, radio := range b.radioGroups {
+		if b.hasRadio(radio) {
+			continue
+		}
+		delete(b.radioGroups, group)
+		for _, item := range b.menuItems {
+			if item.Radio == group {
+				b.radioGroups[group] = item.radio
+				break
+			}
+		}
+	}
+
+	removed.item.Destroy()
+}
+
+// descendantOf tells if item is ancestor itself or is inside its submenus.
+func (item *MenuItem) descendantOf(ancestor *MenuItem) bool {
+	for ; item != nil; item = item.parent {
+		if item == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Block) hasRadio(radio *gtk.RadioMenuItem) bool {
+	for _, item := range b.menuItems {
+		if item.radio == radio {
+			return true
+		}
+	}
+	return false
+}
+
+// clearMenu removes every item from the menu. It must be called on the gtk
+// thread.
+func (b *Block) clearMenu() {
+	for _, item := range b.menuItems {
+		if item.parent == nil {
+			item.item.Destroy()
+		}
+	}
+	for _, item := range b.dynamicMenu {
+		item.Destroy()
+	}
+	b.menuItems = nil
+	b.dynamicMenu = nil
+	b.radioGroups = map[string]*gtk.RadioMenuItem{}
+}
+
+// editMenuItem relabels, enables, disables or moves an item. It must be
+// called on the gtk thread.
+func (b *Block) editMenuItem(edit EditMenu) error {
+	item := b.findMenuItemByID(edit.ID)
+	if item == nil {
+		return fmt.Errorf("couldn't find menu item %s", edit.ID)
+	}
+
+	if edit.Text != "" {
+		if item.Separator {
+			return fmt.Errorf("separators have no text")
+		}
+		item.Text = edit.Text
+		item.item.SetLabel(edit.Text)
+	}
+	if edit.Enable {
+		item.item.SetSensitive(true)
+	}
+	if edit.Disable {
+		item.item.SetSensitive(false)
+	}
+	if edit.Position >= 0 {
+		item.menu.ReorderChild(item.item, edit.Position)
+	}
+	return nil
+}
+
+// refreshMenu runs the state commands of check and radio items, so that
+// they show the current state while the menu is open. It must be called on
+// the gtk thread.
+func (b *Block) refreshMenu() {
+	for _, item := range b.menuItems {
+		if item.check == nil || item.StateCommand == "" {
+			continue
+		}
+		item := item
+		go func() {
+			_, err := b.runner(item.StateCommand).Output()
+			active := err == nil
+			if err != nil && exitCode(err) < 0 {
+				log.Printf("Menu state command finished with error: %v", err)
+			}
+			executeGtkSync(func() error {
+				b.menuUpdating = true
+				item.check.SetActive(active)
+				b.menuUpdating = false
+				return nil
+			})
+		}()
+	}
+}
+
+// MenuEntry is an item printed by a menu command.
+type MenuEntry struct {
+	Text      string      `json:"text"`
+	Command   string      `json:"command"`
+	Checked   *bool       `json:"checked"`
+	Separator bool        `json:"separator"`
+	Submenu   []MenuEntry `json:"submenu"`
+}
+
+// parseMenu parses the output of a menu command. It is either a JSON array
+// of entries, or one entry per line with the text and command separated by
+// a tab, and "-" for separators. Lines without any text are skipped.
+func parseMenu(raw string) ([]MenuEntry, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "[") {
+		var entries []MenuEntry
+		err := json.Unmarshal([]byte(raw), &entries)
+		return entries, err
+	}
+
+	var entries []MenuEntry
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "-" {
+			entries = append(entries, MenuEntry{Separator: true})
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 2)
+		if strings.TrimSpace(fields[0]) == "" {
+			continue
+		}
+		entry := MenuEntry{Text: fields[0]}
+		if len(fields) == 2 {
+			entry.Command = fields[1]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// rebuildMenu replaces the items from the last menu command output with
+// entries, below the items added with add-menu. It must be called on the
+// gtk thread.
+func (b *Block) rebuildMenu(entries []MenuEntry) {
+	for _, item := range b.dynamicMenu {
+		item.Destroy()
+	}
+	b.dynamicMenu = nil
+
+	for _, entry := range entries {
+		item, err := b.newMenuEntry(b.Menu, entry)
+		if err != nil {
+			log.Printf("Can't add menu item %s: %v", entry.Text, err)
+			continue
+		}
+		b.dynamicMenu = append(b.dynamicMenu, item)
+	}
+	b.Menu.ShowAll()
+}
+
+// newMenuEntry creates an item, and its submenu, from a menu command entry
+// and appends it to menu.
+func (b *Block) newMenuEntry(menu *gtk.Menu, entry MenuEntry) (*gtk.MenuItem, error) {
+	var item *gtk.MenuItem
+	switch {
+	case entry.Separator:
+		separator, err := gtk.SeparatorMenuItemNew()
+		if err != nil {
+			return nil, err
+		}
+		item = &separator.MenuItem
+	case entry.Checked != nil:
+		check, err := gtk.CheckMenuItemNewWithLabel(entry.Text)
+		if err != nil {
+			return nil, err
+		}
+		check.SetActive(*entry.Checked)
+		check.Connect("toggled", func() {
+			value := "off"
+			if check.GetActive() {
+				value = "on"
+			}
+			go b.runCommandWith(entry.Command, value)
+		})
+		item = &check.MenuItem
+	default:
+		menuItem, err := gtk.MenuItemNewWithLabel(entry.Text)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry.Submenu) == 0 {
+			menuItem.Connect("activate", func() {
+				go b.runCommand(entry.Command)
+			})
+		}
+		item = menuItem
+	}
+
+	if len(entry.Submenu) > 0 && !entry.Separator {
+		submenu, err := b.newMenu()
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range entry.Submenu {
+			_, err := b.newMenuEntry(submenu, child)
+			if err != nil {
+				return nil, err
+			}
+		}
+		item.SetSubmenu(submenu)
+	}
+
+	menu.Add(item)
+	return item, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMenu(t *testing.T) {
+	on, off := true, false
+
+	tests := []struct {
+		raw     string
+		want    []MenuEntry
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"\n\n", nil, false},
+		{
+			"Suspend\tsystemctl suspend\nReboot\tsystemctl reboot\n",
+			[]MenuEntry{
+				{Text: "Suspend", Command: "systemctl suspend"},
+				{Text: "Reboot", Command: "systemctl reboot"},
+			},
+			false,
+		},
+		{
+			"One\techo 1\n-\nTwo\techo 2",
+			[]MenuEntry{
+				{Text: "One", Command: "echo 1"},
+				{Separator: true},
+				{Text: "Two", Command: "echo 2"},
+			},
+			false,
+		},
+		{
+			"Just text\nTabs\tprintf 'a\\tb'\r\n",
+			[]MenuEntry{
+				{Text: "Just text"},
+				{Text: "Tabs", Command: "printf 'a\\tb'"},
+			},
+			false,
+		},
+		{
+			"A\techo a\n\techo no text\n  \t\nB\techo b",
+			[]MenuEntry{{Text: "A", Command: "echo a"}, {Text: "B", Command: "echo b"}},
+			false,
+		},
+		{
+			`[{"text": "Wifi", "command": "wifi {}", "checked": true}, {"text": "Sound", "checked": false}]`,
+			[]MenuEntry{
+				{Text: "Wifi", Command: "wifi {}", Checked: &on},
+				{Text: "Sound", Checked: &off},
+			},
+			false,
+		},
+		{
+			`[{"text": "Power", "submenu": [{"text": "Off", "command": "poweroff"}, {"separator": true}, {"text": "More", "submenu": [{"text": "Reboot"}]}]}]`,
+			[]MenuEntry{
+				{Text: "Power", Submenu: []MenuEntry{
+					{Text: "Off", Command: "poweroff"},
+					{Separator: true},
+					{Text: "More", Submenu: []MenuEntry{{Text: "Reboot"}}},
+				}},
+			},
+			false,
+		},
+		{`[{"text": "Broken"`, nil, true},
+		{`[{"text": 5}]`, nil, true},
+		{`[{"checked": "yes"}]`, nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseMenu(test.raw)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseMenu(%q) error = %v, want error %v", test.raw, err, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseMenu(%q) = %+v, want %+v", test.raw, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package main
+
+// OpenMenu contains the arguments used for the open-menu command.
+type OpenMenu struct {
+	Name string
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Output is what a block shows for one update from its command.
+type Output struct {
+	Text      string `json:"text"`
+	ShortText string `json:"short_text"`
+	Tooltip   string `json:"tooltip"`
+	Icon      string `json:"icon"`
+	Image     string `json:"image"`
+	// Value is used by level and graph blocks, and is parsed from the
+	// text when it's missing
+	Value *float64 `json:"value"`
+}
+
+func (o Output) equal(other Output) bool {
+	if (o.Value == nil) != (other.Value == nil) {
+		return false
+	}
+	if o.Value != nil && *o.Value != *other.Value {
+		return false
+	}
+	return o.Text == other.Text &&
+		o.ShortText == other.ShortText &&
+		o.Tooltip == other.Tooltip &&
+		o.Icon == other.Icon &&
+		o.Image == other.Image
+}
+
+// parseOutput parses the output of a command. Structured output is a JSON
+// object like {"text": "50%", "tooltip": "Battery"}. Otherwise, like
+// i3blocks, the first line is the text and the second line is the short
+// text. The first line can start with "icon:NAME" or "image:PATH" to change
+// the image.
+func parseOutput(raw string, structured bool) Output {
+	raw = strings.TrimSpace(raw)
+	if structured {
+		var output Output
+		if json.Unmarshal([]byte(raw), &output) == nil {
+			return output
+		}
+	}
+
+	lines := strings.SplitN(raw, "\n", 3)
+	output := Output{}
+	output.Icon, output.Image, output.Text = parseImage(strings.TrimSpace(lines[0]))
+	if len(lines) > 1 {
+		output.ShortText = strings.TrimSpace(lines[1])
+	}
+	return output
+}
+
+var numberPattern = regexp.MustCompile(`-?[0-9]+(\.[0-9]+)?`)
+
+// value returns Value or the first number in the text, so that output like
+// "45%" can feed a level block.
+func (o Output) value() (float64, bool) {
+	if o.Value != nil {
+		return *o.Value, true
+	}
+	number := numberPattern.FindString(o.Text)
+	if number == "" {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	return value, err == nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// PopoverItem is a single widget in the popover of a block.
+type PopoverItem struct {
+	AddPopover
+	block    *Block
+	label    *gtk.Label
+	scale    *gtk.Scale
+	toggle   *gtk.Switch
+	calendar *gtk.Calendar
+	// updating is set while the state is read from the get command, so
+	// that it isn't written straight back
+	updating bool
+
+	// setting is set while the set command of a slider runs, and pending
+	// holds the latest value to set after it
+	mutex      sync.Mutex
+	setting    bool
+	pending    string
+	hasPending bool
+}
+
+// initializePopover creates the popover of a block. It must be called on
+// the gtk thread.
+func (b *Block) initializePopover() error {
+	popover, err := gtk.PopoverNew(b.EventBox)
+	if err != nil {
+		return err
+	}
+	b.Popover = popover
+
+	box, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 6)
+	if err != nil {
+		return err
+	}
+	b.popoverBox = box
+	popover.Add(box)
+	box.Show()
+
+	return applyClass(&popover.Widget, "popover")
+}
+
+// openPopover refreshes the items of the popover and opens it. It must be
+// called on the gtk thread.
+func (b *Block) openPopover() {
+	for _, item := range b.popoverItems {
+		item.refresh()
+	}
+	popupPopoverAt(&b.EventBox.Widget, b.Popover)
+}
+
+// addPopoverItem creates the widgets for an item and packs them into the
+// popover. It must be called on the gtk thread.
+func (b *Block) addPopoverItem(addPopover AddPopover) error {
+	item := &PopoverItem{AddPopover: addPopover, block: b}
+
+	var widget gtk.IWidget
+	switch item.Type {
+	case "label":
+		label, err := gtk.LabelNew(item.Text)
+		if err != nil {
+			return err
+		}
+		label.SetHAlign(gtk.ALIGN_START)
+		item.label = label
+		widget = label
+	case "slider":
+		if item.Max <= item.Min {
+			return fmt.Errorf("slider needs --max greater than --min")
+		}
+		if item.Step <= 0 {
+			return fmt.Errorf("slider needs a positive --step")
+		}
+		scale, err := gtk.ScaleNewWithRange(gtk.ORIENTATION_HORIZONTAL, item.Min, item.Max, item.Step)
+		if err != nil {
+			return err
+		}
+		scale.SetSizeRequest(200, -1)
+		scale.Connect("value-changed", item.sliderChanged)
+		item.scale = scale
+		widget, err = item.row(scale)
+		if err != nil {
+			return err
+		}
+	case "toggle":
+		toggle, err := gtk.SwitchNew()
+		if err != nil {
+			return err
+		}
+		toggle.Connect("notify::active", item.toggleChanged)
+		item.toggle = toggle
+		widget, err = item.row(toggle)
+		if err != nil {
+			return err
+		}
+	case "button":
+		button, err := gtk.ButtonNewWithLabel(item.Text)
+		if err != nil {
+			return err
+		}
+		button.Connect("clicked", func() {
+			b.Popover.Popdown()
+			go item.block.runCommand(item.Command)
+		})
+		widget = button
+	case "calendar":
+		calendar, err := gtk.CalendarNew()
+		if err != nil {
+			return err
+		}
+		calendar.Connect("day-selected-double-click", item.daySelected)
+		item.calendar = calendar
+		widget = calendar
+	default:
+		return fmt.Errorf("unknown popover item type %q", item.Type)
+	}
+
+	b.popoverBox.PackStart(widget, false, false, 0)
+	b.popoverBox.ShowAll()
+	b.popoverItems = append(b.popoverItems, item)
+	item.refresh()
+	return nil
+}
+
+// row puts the item text to the left of a widget.
+func (item *PopoverItem) row(widget gtk.IWidget) (*gtk.Box, error) {
+	box, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 12)
+	if err != nil {
+		return nil, err
+	}
+	if item.Text != "" {
+		label, err := gtk.LabelNew(item.Text)
+		if err != nil {
+			return nil, err
+		}
+		label.SetHAlign(gtk.ALIGN_START)
+		box.PackStart(label, true, true, 0)
+	}
+	box.PackEnd(widget, false, false, 0)
+	return box, nil
+}
+
+// refresh reads the current state of the item when the popover opens. It
+// must be called on the gtk thread.
+func (item *PopoverItem) refresh() {
+	switch {
+	case item.label != nil && item.Command != "":
+		go func() {
+			output, err := item.block.runner(item.Command).Output()
+			if err != nil {
+				log.Printf("Popover label command finished with error: %v", err)
+				return
+			}
+			text := strings.TrimRight(string(output), "\n")
+			executeGtkSync(func() error {
+				item.label.SetText(text)
+				return nil
+			})
+		}()
+	case item.scale != nil && item.GetCommand != "":
+		go func() {
+			output, err := item.block.runner(item.GetCommand).Output()
+			if err != nil {
+				log.Printf("Popover get command finished with error: %v", err)
+				return
+			}
+			value, ok := (Output{Text: string(output)}).value()
+			if !ok {
+				log.Printf("Popover get command printed no number: %q", output)
+				return
+			}
+			executeGtkSync(func() error {
+				item.updating = true
+				item.scale.SetValue(value)
+				item.updating = false
+				return nil
+			})
+		}()
+	case item.toggle != nil && item.GetCommand != "":
+		go func() {
+			_, err := item.block.runner(item.GetCommand).Output()
+			executeGtkSync(func() error {
+				item.updating = true
+				item.toggle.SetActive(err == nil)
+				item.updating = false
+				return nil
+			})
+		}()
+	case item.calendar != nil:
+		now := time.Now()
+		item.calendar.SelectMonth(uint(now.Month()-1), uint(now.Year()))
+		item.calendar.SelectDay(uint(now.Day()))
+	}
+}
+
+func (item *PopoverItem) sliderChanged() {
+	if item.updating {
+		return
+	}
+	value := strconv.FormatFloat(item.scale.GetValue(), 'f', -1, 64)
+	item.set(value)
+}
+
+// set runs the set command with value. Dragging a slider changes it many
+// times a second, so while the command runs only the latest value is kept
+// and set once it has finished.
+func (item *PopoverItem) set(value string) {
+	item.mutex.Lock()
+	defer item.mutex.Unlock()
+
+	item.pending = value
+	item.hasPending = true
+	if !item.setting {
+		item.setting = true
+		go item.runPending()
+	}
+}
+
+func (item *PopoverItem) runPending() {
+	for {
+		item.mutex.Lock()
+		if !item.hasPending {
+			item.setting = false
+			item.mutex.Unlock()
+			return
+		}
+		value := item.pending
+		item.hasPending = false
+		item.mutex.Unlock()
+
+		item.block.runCommandWith(item.SetCommand, value)
+	}
+}
+
+func (item *PopoverItem) toggleChanged() {
+	if item.updating {
+		return
+	}
+	value := "off"
+	if item.toggle.GetActive() {
+		value = "on"
+	}
+	go item.block.runCommandWith(item.SetCommand, value)
+}
+
+func (item *PopoverItem) daySelected() {
+	year, month, day := item.calendar.GetDate()
+	date := fmt.Sprintf("%04d-%02d-%02d", year, month+1, day)
+	go item.block.runCommandWith(item.Command, date)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+// Processes keeps track of the long running commands started by blocks, so
+// that they can be killed when vbar exits.
+type Processes struct {
+	mutex   sync.Mutex
+	running map[*exec.Cmd]struct{}
+}
+
+var processes = &Processes{running: map[*exec.Cmd]struct{}{}}
+
+// Start starts cmd in its own process group.
+func (p *Processes) Start(cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	p.running[cmd] = struct{}{}
+	return nil
+}
+
+// Wait waits for cmd to exit and forgets about it.
+func (p *Processes) Wait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+
+	p.mutex.Lock()
+	delete(p.running, cmd)
+	p.mutex.Unlock()
+
+	return err
+}
+
+// Kill sends SIGTERM to the process group of cmd.
+func (p *Processes) Kill(cmd *exec.Cmd) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.running[cmd]; ok {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+}
+
+// KillAll sends SIGTERM to the process group of every running command.
+func (p *Processes) KillAll() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for cmd := range p.running {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+}
@@ -23,6 +23,13 @@ func (c *Command) AddCSS(a *AddCSS, res *int) (err error) {
 	return
 }
 
+// AddSource add source
+func (c *Command) AddSource(a *AddSource, res *int) (err error) {
+	err = c.window.addSource(*a)
+	*res = errToInt(err)
+	return
+}
+
 // AddMenu add menu
 func (c *Command) AddMenu(a *AddMenu, res *int) (err error) {
 	err = c.window.addMenu(*a)
@@ -30,6 +37,41 @@ func (c *Command) AddMenu(a *AddMenu, res *int) (err error) {
 	return
 }
 
+// RemoveMenu remove menu item
+func (c *Command) RemoveMenu(a *RemoveMenu, res *int) (err error) {
+	err = c.window.removeMenu(*a)
+	*res = errToInt(err)
+	return
+}
+
+// ClearMenu clear menu
+func (c *Command) ClearMenu(a *ClearMenu, res *int) (err error) {
+	err = c.window.clearMenu(*a)
+	*res = errToInt(err)
+	return
+}
+
+// EditMenu edit menu item
+func (c *Command) EditMenu(a *EditMenu, res *int) (err error) {
+	err = c.window.editMenu(*a)
+	*res = errToInt(err)
+	return
+}
+
+// OpenMenu open menu
+func (c *Command) OpenMenu(a *OpenMenu, res *int) (err error) {
+	err = c.window.openMenu(*a)
+	*res = errToInt(err)
+	return
+}
+
+// AddPopover add popover item
+func (c *Command) AddPopover(a *AddPopover, res *int) (err error) {
+	err = c.window.addPopover(*a)
+	*res = errToInt(err)
+	return
+}
+
 // Update update block
 func (c *Command) Update(a *Update, res *int) (err error) {
 	err = c.window.updateBlock(*a)
@@ -37,6 +79,20 @@ func (c *Command) Update(a *Update, res *int) (err error) {
 	return
 }
 
+// Show show block
+func (c *Command) Show(a *Show, res *int) (err error) {
+	err = c.window.showBlock(*a)
+	*res = errToInt(err)
+	return
+}
+
+// Hide hide block
+func (c *Command) Hide(a *Hide, res *int) (err error) {
+	err = c.window.hideBlock(*a)
+	*res = errToInt(err)
+	return
+}
+
 // Remove remove block
 func (c *Command) Remove(a *Remove, res *int) (err error) {
 	err = c.window.removeBlock(*a)
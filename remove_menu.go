@@ -0,0 +1,8 @@
+package main
+
+// RemoveMenu contains the arguments used for the remove-menu command.
+type RemoveMenu struct {
+	Name string
+	Text string
+	ID   string
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Schedule decides when a job should run next.
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// IntervalSchedule runs a job every Interval. When Aligned is set the job
+// runs on wall clock multiples of the interval, so a one minute interval
+// fires at the top of each minute.
+type IntervalSchedule struct {
+	Interval time.Duration
+	Aligned  bool
+}
+
+// Next returns the first time after t that the job should run.
+func (s IntervalSchedule) Next(t time.Time) time.Time {
+	if !s.Aligned {
+		return t.Add(s.Interval)
+	}
+	// align in local time so that hourly or daily intervals follow the
+	// local clock instead of UTC
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(s.Interval).Add(s.Interval).Add(-shift)
+}
+
+// newSchedule creates the schedule for an --interval or a cron --schedule.
+// It returns nil when neither is set.
+func newSchedule(interval string, cron string, align bool) (Schedule, error) {
+	if cron != "" {
+		if interval != "" {
+			return nil, fmt.Errorf("can't have both an interval and a schedule")
+		}
+		return parseCron(cron)
+	}
+
+	duration, err := parseInterval(interval)
+	if err != nil || duration == 0 {
+		return nil, err
+	}
+	return IntervalSchedule{Interval: duration, Aligned: align}, nil
+}
+
+// parseInterval parses whole seconds ("5") or a duration ("500ms", "1m").
+// An empty or zero interval means the command only runs once.
+func parseInterval(interval string) (time.Duration, error) {
+	if interval == "" {
+		return 0, nil
+	}
+
+	var duration time.Duration
+	if seconds, err := strconv.Atoi(interval); err == nil {
+		duration = time.Duration(seconds) * time.Second
+	} else {
+		duration, err = time.ParseDuration(interval)
+		if err != nil {
+			return 0, fmt.Errorf("invalid interval %q", interval)
+		}
+	}
+
+	if duration < 0 {
+		return 0, fmt.Errorf("interval can't be negative, got %q", interval)
+	}
+	return duration, nil
+}
+
+// Job is a function registered with the Scheduler.
+type Job struct {
+	schedule Schedule
+	run      func()
+	next     time.Time
+	index    int
+}
+
+type jobHeap []*Job
+
+func (h jobHeap) Len() int           { return len(h) }
+func (h jobHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+func (h jobHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *jobHeap) Push(x interface{}) {
+	job := x.(*Job)
+	job.index = len(*h)
+	*h = append(*h, job)
+}
+
+func (h *jobHeap) Pop() interface{} {
+	old := *h
+	job := old[len(old)-1]
+	*h = old[:len(old)-1]
+	job.index = -1
+	return job
+}
+
+// Scheduler runs every scheduled job from a single goroutine.
+type Scheduler struct {
+	mutex sync.Mutex
+	jobs  jobHeap
+	wake  chan struct{}
+}
+
+// SchedulerNew creates a new Scheduler and starts its goroutine.
+func SchedulerNew() *Scheduler {
+	s := &Scheduler{wake: make(chan struct{}, 1)}
+	go s.loop()
+	return s
+}
+
+// Add registers run to be called according to schedule. Jobs must not
+// block, since they are called from the scheduler goroutine.
+func (s *Scheduler) Add(schedule Schedule, run func()) *Job {
+	job := &Job{
+		schedule: schedule,
+		run:      run,
+		next:     schedule.Next(time.Now()),
+	}
+
+	s.mutex.Lock()
+	heap.Push(&s.jobs, job)
+	s.mutex.Unlock()
+
+	s.notify()
+	return job
+}
+
+// Remove stops a job from running again.
+func (s *Scheduler) Remove(job *Job) {
+	s.mutex.Lock()
+	if job.index >= 0 && job.index < len(s.jobs) && s.jobs[job.index] == job {
+		heap.Remove(&s.jobs, job.index)
+	}
+	s.mutex.Unlock()
+
+	s.notify()
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) loop() {
+	for {
+		s.mutex.Lock()
+		now := time.Now()
+		for len(s.jobs) > 0 && !s.jobs[0].next.After(now) {
+			job := s.jobs[0]
+			job.run()
+
+			// schedule from the previous due time to avoid drifting, but
+			// don't try to catch up on runs we missed
+			job.next = job.schedule.Next(job.next)
+			if !job.next.After(now) {
+				job.next = job.schedule.Next(now)
+			}
+			heap.Fix(&s.jobs, 0)
+		}
+
+		// wake up at least once a minute, timers don't count time spent
+		// in suspend so wall clock schedules could otherwise run late
+		wait := time.Minute
+		if len(s.jobs) > 0 && time.Until(s.jobs[0].next) < wait {
+			wait = time.Until(s.jobs[0].next)
+		}
+		s.mutex.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		}
+		timer.Stop()
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		interval string
+		want     time.Duration
+		wantErr  bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"5", 5 * time.Second, false},
+		{"500ms", 500 * time.Millisecond, false},
+		{"1.5s", 1500 * time.Millisecond, false},
+		{"1m", time.Minute, false},
+		{"-1s", 0, true},
+		{"-5", 0, true},
+		{"soon", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseInterval(test.interval)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseInterval(%q) error = %v, want error %v", test.interval, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseInterval(%q) = %v, want %v", test.interval, got, test.want)
+		}
+	}
+}
+
+func TestIntervalScheduleNext(t *testing.T) {
+	start := time.Date(2024, 3, 10, 14, 7, 23, 0, time.Local)
+
+	tests := []struct {
+		schedule IntervalSchedule
+		want     time.Time
+	}{
+		{IntervalSchedule{Interval: time.Minute}, start.Add(time.Minute)},
+		{IntervalSchedule{Interval: 500 * time.Millisecond}, start.Add(500 * time.Millisecond)},
+		{IntervalSchedule{Interval: time.Minute, Aligned: true}, time.Date(2024, 3, 10, 14, 8, 0, 0, time.Local)},
+		{IntervalSchedule{Interval: 15 * time.Minute, Aligned: true}, time.Date(2024, 3, 10, 14, 15, 0, 0, time.Local)},
+		{IntervalSchedule{Interval: time.Hour, Aligned: true}, time.Date(2024, 3, 10, 15, 0, 0, 0, time.Local)},
+	}
+
+	for _, test := range tests {
+		got := test.schedule.Next(start)
+		if !got.Equal(test.want) {
+			t.Errorf("%+v.Next(%v) = %v, want %v", test.schedule, start, got, test.want)
+		}
+	}
+}
+
+func TestNewSchedule(t *testing.T) {
+	schedule, err := newSchedule("0", "", false)
+	if err != nil || schedule != nil {
+		t.Errorf("newSchedule with a zero interval = %v, %v, want no schedule", schedule, err)
+	}
+
+	_, err = newSchedule("5", "* * * * *", false)
+	if err == nil {
+		t.Errorf("newSchedule with an interval and a cron schedule should fail")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// scrollGap separates the end of the text from the start of the next copy
+// when scrolling.
+const scrollGap = "     "
+
+// initializeScroll puts the label in a viewport MaxWidth characters wide.
+// Text that doesn't fit scrolls through the viewport, pausing while the
+// pointer is over the block.
+func (b *Block) initializeScroll() error {
+	if !b.Scroll {
+		return nil
+	}
+	if b.MaxWidth <= 0 {
+		return fmt.Errorf("block %s needs a --max-width to scroll", b.Name)
+	}
+
+	return executeGtkSync(func() error {
+		viewport, err := gtk.ViewportNew(nil, nil)
+		if err != nil {
+			return err
+		}
+		adjustment, err := viewport.GetHAdjustment()
+		if err != nil {
+			return err
+		}
+		b.viewport = viewport
+		b.scrollAdjustment = adjustment
+
+		viewport.SetShadowType(gtk.SHADOW_NONE)
+		b.box.Remove(b.Label)
+		viewport.Add(b.Label)
+		b.box.PackStart(viewport, true, true, 0)
+		viewport.Show()
+
+		b.updateScrollWidth()
+		_, err = b.Label.Connect("style-updated", b.updateScrollWidth)
+		if err != nil {
+			return err
+		}
+
+		b.EventBox.AddEvents(int(gdk.ENTER_NOTIFY_MASK | gdk.LEAVE_NOTIFY_MASK))
+		_, err = b.EventBox.Connect("enter-notify-event", func(_ interface{}, event *gdk.Event) {
+			b.pauseScroll(event, true)
+		})
+		if err != nil {
+			return err
+		}
+		_, err = b.EventBox.Connect("leave-notify-event", func(_ interface{}, event *gdk.Event) {
+			b.pauseScroll(event, false)
+		})
+		return err
+	})
+}
+
+// pauseScroll pauses scrolling when the pointer enters the block and
+// resumes it when the pointer leaves. Crossings into and out of the
+// block's own children are ignored.
+func (b *Block) pauseScroll(event *gdk.Event, paused bool) {
+	crossing := gdk.EventCrossingNewFromEvent(event)
+	if crossing.Detail() == gdk.NOTIFY_INFERIOR {
+		return
+	}
+	b.scrollPaused = paused
+	b.updateScrollTick()
+}
+
+// updateScrollWidth makes the viewport wide enough for MaxWidth characters
+// in the current font.
+func (b *Block) updateScrollWidth() {
+	b.scrollWidth = textWidth(&b.Label.Widget, strings.Repeat("0", b.MaxWidth))
+	b.viewport.SetSizeRequest(b.scrollWidth, -1)
+	b.updateScroll()
+}
+
+// updateScroll starts scrolling the label if it doesn't fit, by showing the
+// text twice so that the end of the text is followed by its start. It must
+// be called on the gtk thread.
+func (b *Block) updateScroll() {
+	markup := b.labelMarkup
+	if markup != b.scrollMarkup {
+		b.scrollMarkup = markup
+		b.scrollOffset = 0
+		b.scrollAdjustment.SetValue(0)
+	}
+
+	b.Label.SetMarkup(markup)
+	_, width := b.Label.GetPreferredWidth()
+	if width <= b.scrollWidth {
+		b.scrollLoop = 0
+	} else {
+		b.Label.SetMarkup(markup + scrollGap + markup)
+		_, doubleWidth := b.Label.GetPreferredWidth()
+		b.scrollLoop = float64(doubleWidth - width)
+	}
+	b.updateScrollTick()
+}
+
+// updateScrollTick only keeps the tick callback around while the text is
+// actually moving, so that the frame clock can idle.
+func (b *Block) updateScrollTick() {
+	scrolling := b.scrollLoop > 0 && !b.scrollPaused
+	if scrolling && b.scrollTick == 0 {
+		b.scrollLastFrame = 0
+		b.scrollTick = b.Label.AddTickCallback(b.scrollFrame, 0)
+	} else if !scrolling && b.scrollTick != 0 {
+		b.Label.RemoveTickCallback(b.scrollTick)
+		b.scrollTick = 0
+	}
+}
+
+func (b *Block) scrollFrame(widget *gtk.Widget, frameClock *gdk.FrameClock, userData uintptr) bool {
+	// frame times are in microseconds
+	frameTime := frameClock.GetFrameTime()
+	if b.scrollLastFrame != 0 && b.scrollLoop > 0 {
+		elapsed := float64(frameTime-b.scrollLastFrame) / 1e6
+		b.scrollOffset = math.Mod(b.scrollOffset+elapsed*b.ScrollSpeed, b.scrollLoop)
+		b.scrollAdjustment.SetValue(b.scrollOffset)
+	}
+	b.scrollLastFrame = frameTime
+	return true
+}
@@ -0,0 +1,6 @@
+package main
+
+// Show contains the arguments used for the show command.
+type Show struct {
+	Name string
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// SIGRTMIN and SIGRTMAX as seen by programs using glibc, which keeps the
+// first two real-time signals for itself. This matches `kill -RTMIN+N`.
+const (
+	sigrtmin = 34
+	sigrtmax = 64
+)
+
+// signals receives every signal vbar listens for.
+var signals = make(chan os.Signal, 16)
+
+// blockSignal returns SIGRTMIN+n.
+func blockSignal(n int) (os.Signal, error) {
+	if n < 1 || sigrtmin+n > sigrtmax {
+		return nil, fmt.Errorf("signal must be between 1 and %d, got %d", sigrtmax-sigrtmin, n)
+	}
+	return syscall.Signal(sigrtmin + n), nil
+}
+
+// blockSignalNumber is the inverse of blockSignal.
+func blockSignalNumber(sig os.Signal) (int, bool) {
+	s, ok := sig.(syscall.Signal)
+	if !ok || s <= sigrtmin || s > sigrtmax {
+		return 0, false
+	}
+	return int(s) - sigrtmin, true
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Source runs a command on a schedule and feeds its output to every block
+// that renders from it, so that several blocks can share one command.
+type Source struct {
+	AddSource
+	job *Job
+
+	mutex     sync.Mutex
+	blocks    []*Block
+	hasOutput bool
+	stdout    []byte
+	err       error
+	// running is set while the command runs, and again when it should run
+	// once more after that
+	running bool
+	again   bool
+}
+
+// SourceNew creates a Source, runs its command and schedules it.
+func SourceNew(addSource AddSource) (*Source, error) {
+	s := &Source{AddSource: addSource}
+	if s.Command == "" {
+		return nil, fmt.Errorf("source %s needs a --command", s.Name)
+	}
+
+	schedule, err := newSchedule(s.Interval, s.Schedule, s.Align)
+	if err != nil {
+		return nil, fmt.Errorf("source %s: %v", s.Name, err)
+	}
+
+	s.run()
+	if schedule != nil {
+		s.job = scheduler.Add(schedule, s.run)
+	}
+	return s, nil
+}
+
+// run runs the command and renders every block from the output. Runs
+// asked for while the command is running are merged into a single run
+// after it, so that updating several blocks of a source runs it once.
+func (s *Source) run() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.running {
+		s.again = true
+		return
+	}
+	s.running = true
+
+	go func() {
+		for {
+			stdout, err := Runner{Command: s.Command, Limits: limits}.Output()
+
+			s.mutex.Lock()
+			s.hasOutput = true
+			s.stdout = stdout
+			s.err = err
+			blocks := make([]*Block, len(s.blocks))
+			copy(blocks, s.blocks)
+			again := s.again
+			s.again = false
+			s.running = again
+			s.mutex.Unlock()
+
+			for _, block := range blocks {
+				block.renderSource(stdout, err)
+			}
+			if !again {
+				return
+			}
+		}
+	}()
+}
+
+// Subscribe renders the block from every output of the source, starting
+// with the last one.
+func (s *Source) Subscribe(block *Block) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.blocks = append(s.blocks, block)
+	if s.hasOutput {
+		go block.renderSource(s.stdout, s.err)
+	}
+}
+
+// Unsubscribe stops rendering the block.
+func (s *Source) Unsubscribe(block *Block) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, b := range s.blocks {
+		if b == block {
+			s.blocks = append(s.blocks[:i], s.blocks[i+1:]...)
+			break
+		}
+	}
+}
+
+// initializeSource subscribes blocks to their source.
+func (b *Block) initializeSource() error {
+	if b.Source == "" {
+		return nil
+	}
+	if b.Command != "" || b.TailCommand != "" {
+		return fmt.Errorf("block %s can't have both a source and a command", b.Name)
+	}
+
+	var source *Source
+	executeGtkSync(func() error {
+		source = window.findSource(b.Source)
+		return nil
+	})
+	if source == nil {
+		return fmt.Errorf("couldn't find source %s", b.Source)
+	}
+
+	if b.TooltipTemplate != "" {
+		var err error
+		b.tooltipTemplate, err = parseTemplate(b.Name+"-tooltip", b.TooltipTemplate)
+		if err != nil {
+			return err
+		}
+	}
+
+	b.source = source
+	source.Subscribe(b)
+	return nil
+}
+
+// renderSource shows the output of the source through the --format and
+// --tooltip-template templates of the block.
+func (b *Block) renderSource(stdout []byte, err error) {
+	output, formatErr := b.formatOutput(stdout, err)
+	if formatErr != nil {
+		b.setError(formatErr)
+		return
+	}
+
+	if b.tooltipTemplate != nil {
+		data := templateData(stdout, exitCode(err))
+		tooltip, templateErr := executeTemplate(b.tooltipTemplate, data)
+		switch {
+		case templateErr == nil:
+			output.Tooltip = tooltip
+		case err == nil:
+			b.setError(templateErr)
+			return
+		default:
+			log.Printf("Can't render the tooltip of block %s: %v", b.Name, templateErr)
+		}
+	}
+
+	b.handleOutput(output, err)
+}
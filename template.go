@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// TemplateData is what block templates are evaluated against.
+type TemplateData struct {
+	// Text is the whole output without the final newline
+	Text   string
+	Lines  []string
+	Fields []string
+	// JSON is the parsed output, or nil if it isn't JSON
+	JSON     interface{}
+	ExitCode int
+}
+
+func templateData(stdout []byte, exitCode int) TemplateData {
+	text := strings.TrimRight(string(stdout), "\n")
+	data := TemplateData{
+		Text:     text,
+		Lines:    strings.Split(text, "\n"),
+		Fields:   strings.Fields(text),
+		ExitCode: exitCode,
+	}
+	if json.Unmarshal(stdout, &data.JSON) != nil {
+		data.JSON = nil
+	}
+	return data
+}
+
+var templateFuncs = template.FuncMap{
+	"contains":  strings.Contains,
+	"replace":   strings.ReplaceAll,
+	"trim":      strings.TrimSpace,
+	"match":     match,
+	"padLeft":   padLeft,
+	"padRight":  padRight,
+	"bytes":     formatBytes,
+	"percent":   formatPercent,
+	"duration":  formatDuration,
+	"threshold": threshold,
+}
+
+// toNumber converts template values, which are often strings from the
+// output, to numbers.
+func toNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(v, "%")), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q isn't a number", v)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("%v isn't a number", value)
+}
+
+// padLeft pads text with spaces on the left to width characters, so that
+// numbers line up on the right.
+func padLeft(width int, text interface{}) string {
+	s := fmt.Sprint(text)
+	if n := utf8.RuneCountInString(s); n < width {
+		s = strings.Repeat(" ", width-n) + s
+	}
+	return s
+}
+
+// padRight pads text with spaces on the right to width characters.
+func padRight(width int, text interface{}) string {
+	s := fmt.Sprint(text)
+	if n := utf8.RuneCountInString(s); n < width {
+		s += strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// formatBytes formats a number of bytes like "1.5G".
+func formatBytes(value interface{}) (string, error) {
+	n, err := toNumber(value)
+	if err != nil {
+		return "", err
+	}
+	units := "BKMGTPE"
+	unit := 0
+	for math.Abs(n) >= 1024 && unit < len(units)-1 {
+		n /= 1024
+		unit++
+	}
+
+	// values are rounded to one decimal below 10, so decide on the
+	// precision and unit from the rounded value: 10239 is "10K" rather
+	// than "10.0K", and 1048575 is "1.0M" rather than "1024K"
+	precision := 1
+	if unit == 0 || math.Abs(math.Round(n*10)) >= 100 {
+		precision = 0
+	}
+	if precision == 0 && math.Abs(math.Round(n)) >= 1024 && unit < len(units)-1 {
+		n /= 1024
+		unit++
+		precision = 1
+	}
+	return fmt.Sprintf("%.*f%c", precision, n, units[unit]), nil
+}
+
+// formatPercent formats value as a percentage like "42%". With a total
+// value is a part of it, otherwise it's a fraction between 0 and 1.
+func formatPercent(value interface{}, total ...interface{}) (string, error) {
+	n, err := toNumber(value)
+	if err != nil {
+		return "", err
+	}
+	whole := 1.0
+	if len(total) > 0 {
+		whole, err = toNumber(total[0])
+		if err != nil {
+			return "", err
+		}
+	}
+	if whole == 0 {
+		return "", fmt.Errorf("percent of zero")
+	}
+	return fmt.Sprintf("%.0f%%", n/whole*100), nil
+}
+
+// formatDuration formats a number of seconds like "1h05m", "3m20s" or
+// "42s".
+func formatDuration(value interface{}) (string, error) {
+	n, err := toNumber(value)
+	if err != nil {
+		return "", err
+	}
+	seconds := int64(math.Round(n))
+	if seconds < 0 {
+		return "-" + formatSeconds(-seconds), nil
+	}
+	return formatSeconds(seconds), nil
+}
+
+func formatSeconds(seconds int64) string {
+	switch {
+	case seconds >= 3600:
+		return fmt.Sprintf("%dh%02dm", seconds/3600, seconds%3600/60)
+	case seconds >= 60:
+		return fmt.Sprintf("%dm%02ds", seconds/60, seconds%60)
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+// threshold picks an icon by value. The arguments are the icon for the
+// lowest values followed by pairs of a limit and the icon for values from
+// that limit up, like `threshold .Text "low" 20 "medium" 80 "high"`.
+func threshold(value interface{}, icons ...interface{}) (string, error) {
+	if len(icons)%2 != 1 {
+		return "", fmt.Errorf("threshold needs an icon and then pairs of a limit and an icon")
+	}
+	n, err := toNumber(value)
+	if err != nil {
+		return "", err
+	}
+	icon := icons[0]
+	for i := 1; i < len(icons); i += 2 {
+		limit, err := toNumber(icons[i])
+		if err != nil {
+			return "", err
+		}
+		if n >= limit {
+			icon = icons[i+1]
+		}
+	}
+	return fmt.Sprint(icon), nil
+}
+
+// match returns the first group matched by pattern in text, or the whole
+// match when pattern has no groups.
+func match(pattern string, text string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	matches := re.FindStringSubmatch(text)
+	switch len(matches) {
+	case 0:
+		return "", nil
+	case 1:
+		return matches[0], nil
+	}
+	return matches[1], nil
+}
+
+func parseTemplate(name string, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	return t, nil
+}
+
+func executeTemplate(t *template.Template, data interface{}) (string, error) {
+	var text strings.Builder
+	err := t.Execute(&text, data)
+	if err != nil {
+		return "", err
+	}
+	return text.String(), nil
+}
+
+// initializeFormat parses the --format template.
+func (b *Block) initializeFormat() error {
+	if b.Format == "" {
+		return nil
+	}
+
+	var err error
+	b.format, err = parseTemplate(b.Name, b.Format)
+	return err
+}
+
+// formatOutput renders the output of a command that exited with err
+// through the --format template, and parses the result. When the command
+// failed its error is more useful than the template's, so the template
+// error is only logged.
+func (b *Block) formatOutput(stdout []byte, err error) (Output, error) {
+	if b.format == nil {
+		return b.parseOutput(string(stdout)), nil
+	}
+	text, formatErr := executeTemplate(b.format, templateData(stdout, exitCode(err)))
+	if formatErr != nil {
+		if err == nil {
+			return Output{}, formatErr
+		}
+		log.Printf("Can't format the output of block %s: %v", b.Name, formatErr)
+		return b.parseOutput(string(stdout)), nil
+	}
+	return b.parseOutput(text), nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import "testing"
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		want    string
+		wantErr bool
+	}{
+		{0, "0B", false},
+		{1023, "1023B", false},
+		{1024, "1.0K", false},
+		{1536, "1.5K", false},
+		{10188, "9.9K", false},
+		{10239, "10K", false},
+		{10240, "10K", false},
+		{1048575, "1.0M", false},
+		{1048576, "1.0M", false},
+		{"1610612736", "1.5G", false},
+		{" 2048\n", "2.0K", false},
+		{int64(1) << 60, "1.0E", false},
+		{float64(1 << 62), "4.0E", false},
+		{-1536, "-1.5K", false},
+		{-10239, "-10K", false},
+		{"lots", "", true},
+		{nil, "", true},
+	}
+
+	for _, test := range tests {
+		got, err := formatBytes(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("bytes %#v error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("bytes %#v = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestFormatPercent(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		total   []interface{}
+		want    string
+		wantErr bool
+	}{
+		{0, nil, "0%", false},
+		{0.5, nil, "50%", false},
+		{"0.426", nil, "43%", false},
+		{1, nil, "100%", false},
+		{-0.25, nil, "-25%", false},
+		{1, []interface{}{3}, "33%", false},
+		{"512", []interface{}{"2048"}, "25%", false},
+		{5, []interface{}{0}, "", true},
+		{"half", nil, "", true},
+		{1, []interface{}{"all"}, "", true},
+	}
+
+	for _, test := range tests {
+		got, err := formatPercent(test.value, test.total...)
+		if (err != nil) != test.wantErr {
+			t.Errorf("percent %#v %v error = %v, want error %v", test.value, test.total, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("percent %#v %v = %q, want %q", test.value, test.total, got, test.want)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		want    string
+		wantErr bool
+	}{
+		{0, "0s", false},
+		{42, "42s", false},
+		{59.4, "59s", false},
+		{59.6, "1m00s", false},
+		{200, "3m20s", false},
+		{3599, "59m59s", false},
+		{3600, "1h00m", false},
+		{"3900.7", "1h05m", false},
+		{90000, "25h00m", false},
+		{-42, "-42s", false},
+		{-200, "-3m20s", false},
+		{"soon", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := formatDuration(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("duration %#v error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("duration %#v = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	icons := []interface{}{"low", 20, "medium", "80", "high"}
+
+	tests := []struct {
+		value   interface{}
+		icons   []interface{}
+		want    string
+		wantErr bool
+	}{
+		{0, icons, "low", false},
+		{-5, icons, "low", false},
+		{19.9, icons, "low", false},
+		{20, icons, "medium", false},
+		{"79%", icons, "medium", false},
+		{80, icons, "high", false},
+		{1000, icons, "high", false},
+		{50, []interface{}{"only"}, "only", false},
+		{"full", icons, "", true},
+		{50, []interface{}{"low", 20}, "", true},
+		{50, []interface{}{}, "", true},
+		{50, []interface{}{"low", "half", "high"}, "", true},
+	}
+
+	for _, test := range tests {
+		got, err := threshold(test.value, test.icons...)
+		if (err != nil) != test.wantErr {
+			t.Errorf("threshold %#v %v error = %v, want error %v", test.value, test.icons, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("threshold %#v %v = %q, want %q", test.value, test.icons, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// tooltipCommandMaxAge is how long the output of TooltipCommand is shown
+// before running it again.
+const tooltipCommandMaxAge = time.Second
+
+func (b *Block) initializeTooltip() error {
+	return executeGtkSync(func() error {
+		err := b.EventBox.SetProperty("has-tooltip", true)
+		if err != nil {
+			return err
+		}
+		_, err = b.EventBox.Connect("query-tooltip", func(_ interface{}, x, y int, keyboard bool, tooltip *gtk.Tooltip) bool {
+			markup := b.tooltipMarkup()
+			if markup == "" {
+				return false
+			}
+			tooltip.SetMarkup(markup)
+			return true
+		})
+		return err
+	})
+}
+
+// tooltipMarkup returns the tooltip to show, preferring the error or exit
+// status, then the tooltip from structured output, then TooltipCommand and
+// finally the Tooltip text. It must be called on the gtk thread.
+func (b *Block) tooltipMarkup() string {
+	if b.statusTooltip != "" {
+		return escapeMarkup(b.statusTooltip)
+	}
+
+	tooltip := b.outputTooltip
+	if tooltip == "" && b.TooltipCommand != "" {
+		b.updateTooltipCommand()
+		tooltip = b.commandTooltip
+	}
+	if tooltip == "" {
+		tooltip = b.Tooltip
+	}
+
+	if !isValidMarkup(tooltip) {
+		return escapeMarkup(tooltip)
+	}
+	return tooltip
+}
+
+// updateTooltipCommand runs TooltipCommand in the background if its output
+// is out of date, and asks gtk to show the tooltip again when it's done. It
+// must be called on the gtk thread.
+func (b *Block) updateTooltipCommand() {
+	if b.tooltipRunning || time.Since(b.tooltipUpdated) < tooltipCommandMaxAge {
+		return
+	}
+	b.tooltipRunning = true
+
+	go func() {
+		stdout, err := b.runner(b.TooltipCommand).Output()
+		if err != nil {
+			log.Printf("TooltipCommand for block %s finished with error: %v", b.Name, err)
+		}
+		tooltip := strings.TrimSpace(string(stdout))
+
+		err = executeGtkSync(func() error {
+			b.tooltipRunning = false
+			b.tooltipUpdated = time.Now()
+			if tooltip != b.commandTooltip {
+				b.commandTooltip = tooltip
+				triggerTooltipQuery(&b.EventBox.Widget)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error setting tooltip: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/gotk3/gotk3/glib"
+)
+
+// blockUpdate is the result of one run of a block command, either the
+// output to show or the error it failed with.
+type blockUpdate struct {
+	output Output
+	urgent bool
+	hidden bool
+	err    error
+}
+
+func (u blockUpdate) equal(other blockUpdate) bool {
+	if u.err != nil || other.err != nil {
+		return u.err != nil && other.err != nil && u.err.Error() == other.err.Error()
+	}
+	return u.output.equal(other.output) && u.urgent == other.urgent && u.hidden == other.hidden
+}
+
+// Updates collects block updates from command goroutines and shows them
+// together from a single idle callback on the gtk thread, so that commands
+// don't wait for the gtk thread and the bar is only fitted to the monitor
+// once.
+type Updates struct {
+	mutex     sync.Mutex
+	pending   map[*Block]blockUpdate
+	order     []*Block
+	last      map[*Block]blockUpdate
+	scheduled bool
+}
+
+var updates = &Updates{
+	pending: map[*Block]blockUpdate{},
+	last:    map[*Block]blockUpdate{},
+}
+
+// Push queues an update for a block, replacing any update that hasn't been
+// shown yet. Updates that don't change anything are dropped, except for
+// graph blocks which plot every value.
+func (u *Updates) Push(block *Block, update blockUpdate) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	last, ok := u.last[block]
+	if ok && block.Type != "graph" && last.equal(update) {
+		return
+	}
+	u.last[block] = update
+
+	if _, ok := u.pending[block]; !ok {
+		u.order = append(u.order, block)
+	}
+	u.pending[block] = update
+
+	if !u.scheduled {
+		u.scheduled = true
+		_, err := glib.IdleAdd(func() bool {
+			u.apply()
+			return false
+		})
+		if err != nil {
+			log.Printf("Can't schedule block updates: %v", err)
+			u.scheduled = false
+		}
+	}
+}
+
+// Forget drops everything queued or remembered for a removed block.
+func (u *Updates) Forget(block *Block) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	delete(u.pending, block)
+	delete(u.last, block)
+}
+
+// apply shows every queued update. It must be called on the gtk thread.
+func (u *Updates) apply() {
+	u.mutex.Lock()
+	pending, order := u.pending, u.order
+	u.pending = map[*Block]blockUpdate{}
+	u.order = nil
+	u.scheduled = false
+	u.mutex.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	layouts := window.blockLayouts()
+	for _, block := range order {
+		update, ok := pending[block]
+		if !ok || block.isStopped() {
+			continue
+		}
+		var err error
+		if update.err != nil {
+			err = block.showError(update.err)
+		} else {
+			err = block.showState(update.output, update.urgent, update.hidden)
+		}
+		if err != nil {
+			log.Printf("Error updating block %s: %v", block.Name, err)
+		}
+	}
+	// most updates don't change the width of any block
+	if window.layoutChanged(layouts) {
+		window.fitBlocks()
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gotk3/gotk3/pango"
+)
+
+var textAlignments = map[string]float64{
+	"left":   0,
+	"center": 0.5,
+	"right":  1,
+}
+
+// initializeWidth applies MinWidth, MaxWidth and TextAlign to the label.
+// MinWidth is a number of characters ("10"), pixels ("120px") or a sample
+// string that the block should be wide enough to show ("00:00:00").
+func (b *Block) initializeWidth() error {
+	return executeGtkSync(func() error {
+		chars, pixels := parseMinWidth(b.MinWidth)
+		switch {
+		case chars > 0:
+			b.Label.SetWidthChars(chars)
+		case pixels > 0:
+			b.Label.SetSizeRequest(pixels, -1)
+		case b.MinWidth != "":
+			b.updateSampleWidth()
+			// the width depends on the font, which can change with css
+			_, err := b.Label.Connect("style-updated", b.updateSampleWidth)
+			if err != nil {
+				return err
+			}
+		}
+
+		// scrolling blocks show MaxWidth characters by scrolling instead
+		if b.MaxWidth > 0 && !b.Scroll {
+			b.Label.SetMaxWidthChars(b.MaxWidth)
+			if b.Overflow == "truncate" {
+				b.Label.SetEllipsize(pango.ELLIPSIZE_NONE)
+			} else {
+				b.Label.SetEllipsize(pango.ELLIPSIZE_END)
+			}
+		}
+
+		if b.TextAlign != "" {
+			xAlign, ok := textAlignments[b.TextAlign]
+			if !ok {
+				return fmt.Errorf("invalid text alignment %s", b.TextAlign)
+			}
+			b.Label.SetXAlign(xAlign)
+		}
+
+		return nil
+	})
+}
+
+// parseMinWidth returns the number of characters or pixels in a minimum
+// width, or zero for both when the width is a sample string.
+func parseMinWidth(width string) (chars int, pixels int) {
+	if n, err := strconv.Atoi(width); err == nil {
+		return n, 0
+	}
+	if strings.HasSuffix(width, "px") {
+		if n, err := strconv.Atoi(strings.TrimSuffix(width, "px")); err == nil {
+			return 0, n
+		}
+	}
+	return 0, 0
+}
+
+func (b *Block) updateSampleWidth() {
+	b.Label.SetSizeRequest(textWidth(&b.Label.Widget, b.MinWidth), -1)
+}
+
+// truncate cuts text down to MaxWidth characters when the block truncates
+// instead of ellipsizing. Markup is never truncated, since that could
+// break it, and neither is scrolling text.
+func (b *Block) truncate(text string, markup bool) string {
+	if markup || b.Scroll || b.MaxWidth <= 0 || b.Overflow != "truncate" {
+		return text
+	}
+	runes := []rune(text)
+	if len(runes) <= b.MaxWidth {
+		return text
+	}
+	return string(runes[:b.MaxWidth])
+}
+
+// overflowWidths estimates how wide the block is with its text and with
+// its short text, without changing the label. It must be called on the gtk
+// thread.
+func (b *Block) overflowWidths() (full int, short int) {
+	outer, _ := b.box.GetPreferredWidth()
+	if b.EventBox.GetVisible() {
+		// the event box only adds its margins while it is shown
+		outer, _ = b.EventBox.GetPreferredWidth()
+	}
+	label, _ := b.Label.GetPreferredWidth()
+
+	full = outer - label + b.labelWidth(b.text, label)
+	if b.shortText == "" {
+		return full, full
+	}
+	return full, outer - label + b.labelWidth(b.shortText, label)
+}
+
+// labelWidth estimates the minimum width of the label showing text.
+// Hidden, ellipsized and scrolling labels don't grow with their text, so
+// they keep their current width.
+func (b *Block) labelWidth(text string, current int) int {
+	if !b.Label.GetVisible() || b.viewport != nil || b.Label.GetEllipsize() != pango.ELLIPSIZE_NONE {
+		return current
+	}
+
+	width := markupWidth(&b.Label.Widget, b.labelMarkupFor(text))
+	if request, _ := b.Label.GetSizeRequest(); request > width {
+		width = request
+	}
+	if chars := b.Label.GetWidthChars(); chars > 0 {
+		if min := textWidth(&b.Label.Widget, strings.Repeat("0", chars)); min > width {
+			width = min
+		}
+	}
+	return width
+}
+
+// blockLayout is the state of a block that decides how wide it is.
+type blockLayout struct {
+	text      string
+	shortText string
+	markup    string
+	icon      string
+	image     string
+	visible   bool
+}
+
+func (b *Block) layout() blockLayout {
+	return blockLayout{
+		text:      b.text,
+		shortText: b.shortText,
+		markup:    b.labelMarkup,
+		icon:      b.shownIcon,
+		image:     b.shownImage,
+		visible:   b.visible(),
+	}
+}
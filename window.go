@@ -5,7 +5,7 @@ import "C"
 import (
 	"fmt"
 	"log"
-	"os/exec"
+	"sort"
 
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/gtk"
@@ -20,6 +20,7 @@ type Window struct {
 	lastCenterBlock *gtk.EventBox
 	lastRightBlock  *gtk.EventBox
 	blocks          []*Block
+	sources         []*Source
 	cssApplier      *CSSApplier
 }
 
@@ -73,7 +74,6 @@ func WindowNew() (*Window, error) {
 
 func (w *Window) addBlock(addBlock AddBlock) error {
 	block := &Block{AddBlock: addBlock}
-	w.blocks = append(w.blocks, block)
 
 	err := block.Initialize()
 	if err != nil {
@@ -81,6 +81,10 @@ func (w *Window) addBlock(addBlock AddBlock) error {
 	}
 
 	err = executeGtkSync(func() error {
+		// blocks are only added and removed on the gtk thread, so that
+		// they are always fully initialized when looping over them
+		w.blocks = append(w.blocks, block)
+
 		if block.Left {
 			w.addBlockLeft(block)
 		} else if block.Center {
@@ -88,6 +92,13 @@ func (w *Window) addBlock(addBlock AddBlock) error {
 		} else if block.Right {
 			w.addBlockRight(block)
 		}
+		block.updateVisibility()
+		for _, owner := range w.blocks {
+			if owner.Companion == block.Name {
+				owner.updateVisibility()
+			}
+		}
+		w.fitBlocks()
 
 		return nil
 	})
@@ -129,44 +140,99 @@ func (w *Window) addMenu(addMenu AddMenu) error {
 		return fmt.Errorf("couldn't find block %s", addMenu.Name)
 	}
 
-	if block.Menu == nil {
-		err := executeGtkSync(func() error {
-			menu, err := gtk.MenuNew()
+	return executeGtkSync(func() error {
+		if block.Menu == nil {
+			err := block.initializeMenu()
 			if err != nil {
 				return err
 			}
-			block.Menu = menu
+		}
+		err := block.addMenuItem(addMenu)
+		block.updateFocus()
+		return err
+	})
+}
 
-			err = applyClass(&block.Menu.Widget, "menu")
-			if err != nil {
-				return err
-			}
+func (w *Window) removeMenu(removeMenu RemoveMenu) error {
+	block := w.findBlock(removeMenu.Name)
+	if block == nil {
+		return fmt.Errorf("couldn't find block %s", removeMenu.Name)
+	}
 
-			_, err = block.EventBox.Connect("button-release-event", func() {
-				popupMenuAt(&block.EventBox.Widget, block.Menu)
-			})
-			return err
-		})
-		if err != nil {
-			return err
+	return executeGtkSync(func() error {
+		var item *MenuItem
+		name := removeMenu.ID
+		if name != "" {
+			item = block.findMenuItemByID(name)
+		} else {
+			name = removeMenu.Text
+			item = block.findMenuItem(name)
+		}
+		if item == nil {
+			return fmt.Errorf("couldn't find menu item %s", name)
 		}
+		block.removeMenuItem(item)
+		block.updateFocus()
+		return nil
+	})
+}
+
+func (w *Window) clearMenu(clearMenu ClearMenu) error {
+	block := w.findBlock(clearMenu.Name)
+	if block == nil {
+		return fmt.Errorf("couldn't find block %s", clearMenu.Name)
 	}
 
 	return executeGtkSync(func() error {
-		menuItem, err := gtk.MenuItemNewWithLabel(addMenu.Text)
-		if err != nil {
-			return err
+		if block.Menu != nil {
+			block.clearMenu()
+		}
+		block.updateFocus()
+		return nil
+	})
+}
+
+func (w *Window) editMenu(editMenu EditMenu) error {
+	block := w.findBlock(editMenu.Name)
+	if block == nil {
+		return fmt.Errorf("couldn't find block %s", editMenu.Name)
+	}
+
+	return executeGtkSync(func() error {
+		return block.editMenuItem(editMenu)
+	})
+}
+
+func (w *Window) openMenu(openMenu OpenMenu) error {
+	block := w.findBlock(openMenu.Name)
+	if block == nil {
+		return fmt.Errorf("couldn't find block %s", openMenu.Name)
+	}
+
+	return executeGtkSync(func() error {
+		if !block.hasMenu() {
+			return fmt.Errorf("block %s has no menu", openMenu.Name)
 		}
-		menuItem.Connect("activate", func() {
-			cmd := exec.Command("/bin/bash", "-c", addMenu.Command)
-			err = cmd.Run()
+		block.activateMenu()
+		return nil
+	})
+}
+
+func (w *Window) addPopover(addPopover AddPopover) error {
+	block := w.findBlock(addPopover.Name)
+	if block == nil {
+		return fmt.Errorf("couldn't find block %s", addPopover.Name)
+	}
+
+	return executeGtkSync(func() error {
+		if block.Popover == nil {
+			err := block.initializePopover()
 			if err != nil {
-				log.Printf("Command finished with error: %v", err)
+				return err
 			}
-		})
-		block.Menu.Add(menuItem)
-		block.Menu.ShowAll()
-		return nil
+			block.updateFocus()
+		}
+		return block.addPopoverItem(addPopover)
 	})
 }
 
@@ -180,12 +246,275 @@ func (w *Window) updateBlock(update Update) error {
 	return nil
 }
 
+// fitBlocks makes the bar fit on the monitor by switching blocks to their
+// short text, and then by hiding blocks, lowest priority first. The state
+// every block should have is worked out from estimated widths first, so
+// that only the blocks whose state changes are touched. It must be called
+// on the gtk thread.
+func (w *Window) fitBlocks() {
+	monitorDimensions, err := getMonitorDimensions(w.gtkWindow)
+	if err != nil {
+		log.Printf("Can't fit blocks: %v", err)
+		return
+	}
+
+	blocks := make([]*Block, len(w.blocks))
+	copy(blocks, w.blocks)
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].Priority < blocks[j].Priority
+	})
+
+	// ellipsized blocks can shrink, so compare the minimum width
+	barWidth, _ := w.gtkWindow.GetPreferredWidth()
+	overflows := func() bool {
+		width, _ := w.gtkWindow.GetPreferredWidth()
+		return width > monitorDimensions.Width
+	}
+
+	fits := map[*Block]*blockFit{}
+	for _, block := range blocks {
+		fit := &blockFit{block: block}
+		fit.full, fit.short = block.overflowWidths()
+		if block.visible() {
+			width, _ := block.EventBox.GetPreferredWidth()
+			barWidth -= width
+		}
+		fits[block] = fit
+	}
+	owners := map[*Block]*blockFit{}
+	for _, block := range blocks {
+		if block.Companion == "" {
+			continue
+		}
+		if companion := w.findBlock(block.Companion); companion != nil {
+			owners[companion] = fits[block]
+		}
+	}
+
+	width := func() int {
+		total := barWidth
+		for _, fit := range fits {
+			if fit.visible(owners, 0) {
+				total += fit.width()
+			}
+		}
+		return total
+	}
+	for _, block := range blocks {
+		if width() <= monitorDimensions.Width {
+			break
+		}
+		if block.shortText != "" {
+			fits[block].useShortText = true
+		}
+	}
+	for _, block := range blocks {
+		if width() <= monitorDimensions.Width {
+			break
+		}
+		fits[block].hidden = true
+	}
+
+	for _, block := range blocks {
+		fit := fits[block]
+		if block.useShortText != fit.useShortText || block.overflowHidden != fit.hidden {
+			block.setOverflow(fit.useShortText, fit.hidden)
+		}
+	}
+
+	// the estimates can be off, for example with markup the label
+	// rejects, so keep going the slow way if the bar still overflows
+	for _, block := range blocks {
+		if !overflows() {
+			return
+		}
+		if block.shortText != "" && !block.useShortText && !block.overflowHidden {
+			block.setOverflow(true, false)
+		}
+	}
+	for _, block := range blocks {
+		if !overflows() {
+			return
+		}
+		if !block.overflowHidden {
+			block.setOverflow(block.useShortText, true)
+		}
+	}
+}
+
+// blockLayouts returns the layout of every block, to tell with
+// layoutChanged if the bar needs to be fitted again. It must be called on
+// the gtk thread.
+func (w *Window) blockLayouts() map[*Block]blockLayout {
+	layouts := make(map[*Block]blockLayout, len(w.blocks))
+	for _, block := range w.blocks {
+		layouts[block] = block.layout()
+	}
+	return layouts
+}
+
+// layoutChanged tells if any block changed its layout since layouts were
+// taken. It must be called on the gtk thread.
+func (w *Window) layoutChanged(layouts map[*Block]blockLayout) bool {
+	if len(layouts) != len(w.blocks) {
+		return true
+	}
+	for _, block := range w.blocks {
+		layout, ok := layouts[block]
+		if !ok || layout != block.layout() {
+			return true
+		}
+	}
+	return false
+}
+
+// blockFit is the overflow state fitBlocks picks for a block.
+type blockFit struct {
+	block        *Block
+	full         int
+	short        int
+	useShortText bool
+	hidden       bool
+}
+
+func (f *blockFit) width() int {
+	if f.useShortText {
+		return f.short
+	}
+	return f.full
+}
+
+// visible tells if the block would be shown in this state. Companions are
+// hidden along with their owner; depth stops companion loops.
+func (f *blockFit) visible(owners map[*Block]*blockFit, depth int) bool {
+	if f.hidden || !f.block.wantsVisible() {
+		return false
+	}
+	owner, ok := owners[f.block]
+	if !ok || depth > len(owners) {
+		return true
+	}
+	return owner.visible(owners, depth+1)
+}
+
+// updateUrgency flashes the bar while any block that wants to flash it is
+// urgent. It must be called on the gtk thread.
+func (w *Window) updateUrgency() {
+	urgent := false
+	for _, block := range w.blocks {
+		if block.FlashBar && block.urgent {
+			urgent = true
+			break
+		}
+	}
+
+	w.gtkWindow.SetUrgencyHint(urgent)
+	if urgent {
+		applyClass(&w.gtkBar.Widget, "urgent")
+	} else {
+		removeClass(&w.gtkBar.Widget, "urgent")
+	}
+}
+
+// signalBlocks updates the blocks that asked for signal n, running a
+// source shared by several of them only once. It's called from the signal
+// goroutine, so the blocks are looked up on the gtk thread.
+func (w *Window) signalBlocks(n int) {
+	var blocks []*Block
+	sources := map[*Source]bool{}
+	err := executeGtkSync(func() error {
+		for _, block := range w.blocks {
+			if block.Signal != n || (block.Command == "" && block.source == nil) {
+				continue
+			}
+			if block.source != nil {
+				if sources[block.source] {
+					continue
+				}
+				sources[block.source] = true
+			}
+			blocks = append(blocks, block)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Can't signal blocks: %v", err)
+		return
+	}
+
+	for _, block := range blocks {
+		block.startUpdatingLabel()
+	}
+}
+
+func (w *Window) showBlock(show Show) error {
+	return w.setBlockHidden(show.Name, false)
+}
+
+func (w *Window) hideBlock(hide Hide) error {
+	return w.setBlockHidden(hide.Name, true)
+}
+
+func (w *Window) setBlockHidden(name string, hidden bool) error {
+	block := w.findBlock(name)
+	if block == nil {
+		return fmt.Errorf("couldn't find block %s", name)
+	}
+
+	return executeGtkSync(func() error {
+		block.userHidden = hidden
+		block.updateVisibility()
+		w.fitBlocks()
+		return nil
+	})
+}
+
 func (w *Window) removeBlock(remove Remove) error {
 	block := w.findBlock(remove.Name)
 	if block == nil {
 		return fmt.Errorf("couldn't find block %s", remove.Name)
 	}
-	block.EventBox.Destroy()
+	block.stop()
+	return executeGtkSync(func() error {
+		for i, b := range w.blocks {
+			if b == block {
+				w.blocks = append(w.blocks[:i], w.blocks[i+1:]...)
+				break
+			}
+		}
+		block.EventBox.Destroy()
+		// the bar may have been flashing for this block
+		w.updateUrgency()
+		w.fitBlocks()
+		return nil
+	})
+}
+
+func (w *Window) addSource(addSource AddSource) error {
+	// sources are only looked up and added on the gtk thread, so that two
+	// sources with the same name can't be added at once
+	return executeGtkSync(func() error {
+		if w.findSource(addSource.Name) != nil {
+			return fmt.Errorf("source %s already exists", addSource.Name)
+		}
+
+		source, err := SourceNew(addSource)
+		if err != nil {
+			return err
+		}
+		w.sources = append(w.sources, source)
+		return nil
+	})
+}
+
+// findSource returns the source called name. It must be called on the gtk
+// thread.
+func (w *Window) findSource(name string) *Source {
+	for _, source := range w.sources {
+		if source.Name == name {
+			return source
+		}
+	}
 	return nil
 }
 
@@ -216,7 +545,9 @@ func (w *Window) addBlockLeft(block *Block) {
 func (w *Window) addBlockCenter(block *Block) {
 	block.EventBox.SetHAlign(gtk.ALIGN_CENTER)
 	block.EventBox.SetHExpand(true)
-	block.Label.SetEllipsize(pango.ELLIPSIZE_END)
+	if block.Overflow != "truncate" && !block.Scroll {
+		block.Label.SetEllipsize(pango.ELLIPSIZE_END)
+	}
 
 	if w.lastCenterBlock != nil {
 		w.gtkBar.AttachNextTo(block.EventBox, w.lastCenterBlock, gtk.POS_RIGHT, 1, 1)